@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/akhilmk/gowise/internal/config"
+)
+
+// serverConfig holds the listener settings, read from the environment and
+// CONFIG_FILE like every other package's settings.
+type serverConfig struct {
+	Port string
+	// RedirectPort, when set with TLS, serves plain HTTP that redirects to HTTPS.
+	RedirectPort string
+	CertFile     string
+	KeyFile      string
+
+	FrontendDir       string
+	StaticCacheMaxAge time.Duration
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+// loadServerConfig resolves the server settings from the environment and
+// the config file at path.
+func loadServerConfig(path string) (serverConfig, error) {
+	src, err := config.Load(path)
+	if err != nil {
+		return serverConfig{}, err
+	}
+
+	cfg := serverConfig{
+		Port:         src.String("PORT", "8081"),
+		RedirectPort: src.String("HTTP_REDIRECT_PORT", ""),
+		CertFile:     src.String("TLS_CERT_FILE", ""),
+		KeyFile:      src.String("TLS_KEY_FILE", ""),
+
+		FrontendDir:       src.String("FRONTEND_DIR", "frontend/dist"),
+		StaticCacheMaxAge: src.Duration("STATIC_CACHE_MAX_AGE", 365*24*time.Hour),
+		ReadHeaderTimeout: src.Duration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       src.Duration("SERVER_READ_TIMEOUT", 5*time.Minute),
+		// Uploads stream progress for as long as embedding takes and lift this per request.
+		WriteTimeout: src.Duration("SERVER_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:  src.Duration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+	}
+
+	return cfg, src.Err()
+}
+
+// Validate reports every invalid setting in c.
+func (c serverConfig) Validate() error {
+	var v config.Checker
+	v.Check(validPort(c.Port), "PORT", "must be a port number, got %q", c.Port)
+	v.Check(c.RedirectPort == "" || validPort(c.RedirectPort), "HTTP_REDIRECT_PORT", "must be a port number, got %q", c.RedirectPort)
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"STATIC_CACHE_MAX_AGE", c.StaticCacheMaxAge},
+		{"SERVER_READ_HEADER_TIMEOUT", c.ReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT", c.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", c.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", c.IdleTimeout},
+	} {
+		v.Check(d.value >= 0, d.key, "must not be negative, got %s", d.value)
+	}
+	return v.Err()
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
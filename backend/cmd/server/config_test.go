@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadServerConfigFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"PORT": 9090, "SERVER_WRITE_TIMEOUT": "5m", "TLS_CERT_FILE": "/certs/tls.crt"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PORT", "")
+	t.Setenv("SERVER_WRITE_TIMEOUT", "")
+	t.Setenv("TLS_CERT_FILE", "/env/tls.crt")
+
+	cfg, err := loadServerConfig(path)
+	if err != nil {
+		t.Fatalf("loadServerConfig: %v", err)
+	}
+	if cfg.Port != "9090" {
+		t.Errorf("Port = %q, want the file's 9090", cfg.Port)
+	}
+	if cfg.WriteTimeout != 5*time.Minute {
+		t.Errorf("WriteTimeout = %s, want the file's 5m", cfg.WriteTimeout)
+	}
+	if cfg.CertFile != "/env/tls.crt" {
+		t.Errorf("CertFile = %q, want the environment to win", cfg.CertFile)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestServerConfigRejectsBadValues(t *testing.T) {
+	t.Setenv("PORT", "http")
+	t.Setenv("SERVER_IDLE_TIMEOUT", "soon")
+
+	cfg, err := loadServerConfig("")
+	if err == nil || !strings.Contains(err.Error(), "SERVER_IDLE_TIMEOUT") {
+		t.Errorf("loadServerConfig error = %v, want the bad duration reported", err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "PORT") {
+		t.Errorf("Validate error = %v, want the bad port reported", err)
+	}
+}
@@ -2,39 +2,115 @@ package main
 
 import (
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/akhilmk/gowise/internal/auth"
 	"github.com/akhilmk/gowise/internal/document"
+	"github.com/akhilmk/gowise/internal/middleware"
 )
 
 func main() {
-	port := getEnv("PORT", "8081")
+	// Load and validate all configuration before anything starts serving.
+	configFile := os.Getenv("CONFIG_FILE")
+	srvConfig, err := loadServerConfig(configFile)
+	if err == nil {
+		err = srvConfig.Validate()
+	}
+	if err != nil {
+		log.Fatalf("[CONFIG ERROR] Invalid server configuration:\n%v", err)
+	}
+	port := srvConfig.Port
 	log.Printf("gowise server starting on :%s...", port)
 
+	authConfig, err := auth.LoadConfig(configFile)
+	if err == nil {
+		err = authConfig.Validate()
+	}
+	if err != nil {
+		log.Fatalf("[CONFIG ERROR] Invalid auth configuration:\n%v", err)
+	}
+	docConfig, err := document.LoadConfig(configFile)
+	if err == nil {
+		err = docConfig.Validate()
+	}
+	if err != nil {
+		log.Fatalf("[CONFIG ERROR] Invalid document configuration:\n%v", err)
+	}
+
 	mux := http.NewServeMux()
 
-	// Initialize Handlers (Config loaded internally)
-	authHandler := auth.NewHandler()
-	docHandler := document.NewHandler()
+	// Initialize Handlers
+	authHandler := auth.NewHandler(authConfig)
+	docHandler := document.NewHandler(docConfig)
 
 	// Register Routes
 	authHandler.RegisterRoutes(mux)
-	docHandler.RegisterRoutes(mux, authHandler.Middleware)
+	docHandler.RegisterRoutes(mux, authHandler.Middleware, authHandler.WithRole(auth.RoleAdmin))
 
-	// Public Health Check
+	// Public Health and Readiness Checks
 	mux.HandleFunc("/api/health", handleHealth)
+	mux.HandleFunc("/api/ready", docHandler.HandleReady)
+
+	// Serve Frontend, falling back to index.html for client-side routes
+	mux.Handle("/", spaHandler(srvConfig.FrontendDir, srvConfig.StaticCacheMaxAge))
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(mux),
+		ReadHeaderTimeout: srvConfig.ReadHeaderTimeout,
+		ReadTimeout:       srvConfig.ReadTimeout,
+		WriteTimeout:      srvConfig.WriteTimeout,
+		IdleTimeout:       srvConfig.IdleTimeout,
+	}
 
-	// Serve Frontend
-	fs := http.FileServer(http.Dir("frontend/dist"))
-	mux.Handle("/", fs)
+	certFile := srvConfig.CertFile
+	keyFile := srvConfig.KeyFile
+	if certFile != "" && keyFile != "" {
+		if redirectPort := srvConfig.RedirectPort; redirectPort != "" {
+			go serveHTTPSRedirect(redirectPort, port)
+		}
+		log.Printf("TLS enabled (cert: %s)", certFile)
+		if err := server.ListenAndServeTLS(certFile, keyFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if certFile != "" || keyFile != "" {
+		log.Printf("[CONFIG WARNING] Both TLS_CERT_FILE and TLS_KEY_FILE are required for TLS, serving plain HTTP")
+	}
 
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// serveHTTPSRedirect listens for plain HTTP and redirects every request to the TLS port.
+func serveHTTPSRedirect(redirectPort, tlsPort string) {
+	log.Printf("HTTP->HTTPS redirect listening on :%s", redirectPort)
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	server := &http.Server{
+		Addr:              ":" + redirectPort,
+		Handler:           redirect,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		log.Printf("[REDIRECT ERROR] HTTP redirect listener stopped: %v", err)
+	}
+}
+
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -43,10 +119,3 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status":"ok","service":"gowise","version":"1.0.0"}`))
 }
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
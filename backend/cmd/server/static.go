@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// assetsDir is where the frontend build writes its output. Files copied from
+// public/ land at the root instead and keep their names across deploys.
+const assetsDir = "/assets/"
+
+// hashedAsset matches the "-<hash>.<ext>" suffix the build gives its output,
+// e.g. "index-B3x9kQ2a.js". Hashes are base64url, so they may contain - and _.
+var hashedAsset = regexp.MustCompile(`-[A-Za-z0-9_-]{8,}\.[A-Za-z0-9]+$`)
+
+// immutableAsset reports whether urlPath names content-hashed build output,
+// whose contents never change under the same name.
+func immutableAsset(urlPath string) bool {
+	return strings.HasPrefix(urlPath, assetsDir) && hashedAsset.MatchString(path.Base(urlPath))
+}
+
+// spaHandler serves the bundled frontend from dir. Paths that don't name a
+// file are client-side routes and get index.html so deep links work, except
+// under /api/ and for paths that look like assets (have an extension), which
+// still get a real 404.
+//
+// Every file gets an ETag. Hashed assets under /assets/ are cached for maxAge and marked
+// immutable; everything else, index.html included, must be revalidated so a
+// new deploy is picked up immediately.
+func spaHandler(dir string, maxAge time.Duration) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	index := filepath.Join(dir, "index.html")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		if urlPath == "/api" || strings.HasPrefix(urlPath, "/api/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		name := filepath.Join(dir, filepath.FromSlash(urlPath))
+		info, err := os.Stat(name)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) || path.Ext(urlPath) != "" {
+			if err == nil && info.IsDir() {
+				// The file server answers directories with their index.html.
+				info, err = os.Stat(filepath.Join(name, "index.html"))
+				urlPath = "/index.html"
+			}
+			if err == nil {
+				setCacheHeaders(w, info, immutableAsset(urlPath), maxAge)
+			}
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		if info, err := os.Stat(index); err == nil {
+			setCacheHeaders(w, info, false, maxAge)
+		}
+		http.ServeFile(w, r, index)
+	})
+}
+
+// setCacheHeaders sets a weak ETag derived from the file's size and
+// modification time, which the file server then uses for If-None-Match.
+func setCacheHeaders(w http.ResponseWriter, info os.FileInfo, immutable bool, maxAge time.Duration) {
+	w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	if immutable && maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int64(maxAge.Seconds())))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+}
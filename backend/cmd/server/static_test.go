@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestImmutableAsset(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/assets/index-B3x9kQ2a.js", want: true},
+		{path: "/assets/index-Bx_k-Qza.css", want: true},
+		{path: "/assets/logo-abcdefgh.svg", want: true},
+		{path: "/app-settings.js", want: false},
+		{path: "/assets/app-settings", want: false},
+		{path: "/assets/app.js", want: false},
+		{path: "/favicon.png", want: false},
+		{path: "/index.html", want: false},
+	}
+	for _, tt := range tests {
+		if got := immutableAsset(tt.path); got != tt.want {
+			t.Errorf("immutableAsset(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSPAHandlerCacheHeaders(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"index.html", "app-settings.js", "assets/index-B3x9kQ2a.js"} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := spaHandler(dir, time.Hour)
+
+	tests := []struct {
+		path, want string
+	}{
+		{path: "/assets/index-B3x9kQ2a.js", want: "public, max-age=3600, immutable"},
+		{path: "/app-settings.js", want: "no-cache"},
+		{path: "/", want: "no-cache"},
+		{path: "/some/route", want: "no-cache"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", tt.path, rec.Code)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s: Cache-Control %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
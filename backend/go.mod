@@ -7,3 +7,7 @@ require github.com/google/uuid v1.6.0
 require github.com/golang-jwt/jwt/v5 v5.3.1
 
 require github.com/ledongthuc/pdf v0.0.0-20250511090121-5959a4027728
+
+require golang.org/x/text v0.41.0
+
+require golang.org/x/crypto v0.55.0
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// APIKeyHeader is the request header carrying a static API key.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a static credential for server-to-server clients.
+type APIKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	Role string `json:"role"`
+}
+
+// loadAPIKeys reads keys from API_KEYS ("name:key:role" entries, comma-separated;
+// role defaults to reader) and from the JSON array in API_KEYS_FILE.
+func loadAPIKeys(spec, path string) ([]APIKey, error) {
+	var keys []APIKey
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid API_KEYS entry %q (want name:key[:role])", parts[0])
+		}
+		key := APIKey{Name: parts[0], Key: parts[1], Role: RoleReader}
+		if len(parts) == 3 && parts[2] != "" {
+			key.Role = parts[2]
+		}
+		keys = append(keys, key)
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API keys file: %w", err)
+		}
+		var fileKeys []APIKey
+		if err := json.Unmarshal(data, &fileKeys); err != nil {
+			return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+		}
+		for _, key := range fileKeys {
+			if key.Key == "" {
+				return nil, fmt.Errorf("API key %q in %s has an empty key", key.Name, path)
+			}
+			if key.Role == "" {
+				key.Role = RoleReader
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// lookupAPIKey finds the key matching presented. Every configured key is
+// compared (on fixed-length digests) so timing doesn't reveal which one matched.
+func (h *Handler) lookupAPIKey(presented string) (APIKey, bool) {
+	sum := sha256.Sum256([]byte(presented))
+	var match APIKey
+	found := false
+	for _, key := range h.apiKeys {
+		want := sha256.Sum256([]byte(key.Key))
+		if subtle.ConstantTimeCompare(sum[:], want[:]) == 1 {
+			match = key
+			found = true
+		}
+	}
+	return match, found
+}
+
+// APIKeyMiddleware authenticates requests by the X-API-Key header only.
+// Middleware also accepts API keys, so use this directly only for routes
+// that should never accept a JWT.
+func (h *Handler) APIKeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		presented := r.Header.Get(APIKeyHeader)
+		if presented == "" {
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+
+		key, ok := h.lookupAPIKey(presented)
+		if !ok {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		claims := &Claims{Username: "apikey:" + key.Name, Role: key.Role}
+		next(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, claims)))
+	}
+}
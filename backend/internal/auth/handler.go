@@ -1,12 +1,17 @@
 package auth
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
+	"github.com/akhilmk/gowise/internal/config"
+	"github.com/akhilmk/gowise/internal/httpjson"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -15,29 +20,130 @@ type Config struct {
 	AdminUser string
 	AdminPass string
 	JWTSecret []byte
+	// Audience is set as the "aud" claim at login and required by Middleware ("" = not checked).
+	Audience string
+	// Leeway tolerates clock skew between services when checking exp/nbf/iat.
+	Leeway time.Duration
+
+	// UsersFile enables multi-user accounts with hashed passwords persisted as JSON.
+	// When empty, only the ADMIN_USERNAME/ADMIN_PASSWORD account exists.
+	UsersFile         string
+	MinPasswordLength int
+
+	// APIKeys and APIKeysFile configure static keys accepted via X-API-Key.
+	APIKeys     string
+	APIKeysFile string
+
+	// Production is set when ENV or APP_ENV is "production" and turns unsafe
+	// defaults into errors.
+	Production bool
 }
 
-// Handler handles authentication logic.
+// defaultJWTSecret is the placeholder secret used when JWT_SECRET is unset.
+const defaultJWTSecret = "change_me_in_prod"
+
+// minJWTSecretLength is the shortest HMAC-SHA256 key accepted in production;
+// shorter secrets make signed tokens practical to brute-force.
+const minJWTSecretLength = 32
+
+// Handler handles authentication logic. It is safe for concurrent use: the
+// config and API keys are read-only after NewHandler, and the user store
+// guards its own state.
 type Handler struct {
-	config Config
+	config  Config
+	users   *userStore
+	apiKeys []APIKey
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Roles carried in the JWT. Admins can do everything; readers can only search and browse.
+const (
+	RoleAdmin  = "admin"
+	RoleReader = "reader"
+)
+
+type contextKey struct{}
+
+// ClaimsFromContext returns the claims stored by Middleware for an authenticated request.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// LoadConfig builds the auth configuration from the JSON file at path (may be
+// empty) overlaid with environment variables. Values that fail to parse are
+// reported in the returned error; call Validate for semantic checks.
+func LoadConfig(path string) (Config, error) {
+	src, err := config.Load(path)
+	if err != nil {
+		return Config{}, err
 	}
-	return defaultValue
+
+	cfg := Config{
+		AdminUser: src.String("ADMIN_USERNAME", "admin"),
+		AdminPass: src.String("ADMIN_PASSWORD", "secret"),
+		JWTSecret: []byte(src.String("JWT_SECRET", defaultJWTSecret)),
+		Audience:  src.String("JWT_AUDIENCE", ""),
+		Leeway:    src.Duration("JWT_LEEWAY", 30*time.Second),
+
+		UsersFile:         src.String("USERS_FILE", ""),
+		MinPasswordLength: src.Int("MIN_PASSWORD_LENGTH", 8),
+
+		APIKeys:     src.String("API_KEYS", ""),
+		APIKeysFile: src.String("API_KEYS_FILE", ""),
+
+		Production: src.String("ENV", src.String("APP_ENV", "")) == "production",
+	}
+
+	return cfg, src.Err()
 }
 
-// NewHandler creates a new auth handler.
-func NewHandler() *Handler {
-	return &Handler{
-		config: Config{
-			AdminUser: getEnv("ADMIN_USERNAME", "admin"),
-			AdminPass: getEnv("ADMIN_PASSWORD", "secret"),
-			JWTSecret: []byte(getEnv("JWT_SECRET", "change_me_in_prod")),
-		},
+// Validate reports every invalid or unsafe setting in c.
+func (c Config) Validate() error {
+	var v config.Checker
+	v.Check(c.AdminUser != "", "ADMIN_USERNAME", "must not be empty")
+	v.Check(len(c.JWTSecret) > 0, "JWT_SECRET", "must not be empty")
+	if c.Production && len(c.JWTSecret) > 0 {
+		if string(c.JWTSecret) == defaultJWTSecret {
+			v.Check(false, "JWT_SECRET", "is the default %q; set a secret of your own in production", defaultJWTSecret)
+		} else {
+			v.Check(len(c.JWTSecret) >= minJWTSecretLength, "JWT_SECRET", "must be at least %d bytes in production, got %d", minJWTSecretLength, len(c.JWTSecret))
+		}
 	}
+	v.Check(c.MinPasswordLength > 0, "MIN_PASSWORD_LENGTH", "must be positive, got %d", c.MinPasswordLength)
+	v.Check(c.MinPasswordLength <= maxPasswordLength, "MIN_PASSWORD_LENGTH", "must be at most %d, the longest password bcrypt accepts, got %d", maxPasswordLength, c.MinPasswordLength)
+	v.Check(c.Leeway >= 0, "JWT_LEEWAY", "must not be negative")
+	return v.Err()
+}
+
+// NewHandler creates a new auth handler from a validated configuration.
+func NewHandler(cfg Config) *Handler {
+	h := &Handler{config: cfg}
+
+	if string(cfg.JWTSecret) == defaultJWTSecret {
+		log.Printf("[AUTH] WARNING: JWT_SECRET is the default %q; anyone can forge tokens. Set JWT_SECRET before exposing this server (startup fails with ENV=production).", defaultJWTSecret)
+	} else if len(cfg.JWTSecret) < minJWTSecretLength {
+		log.Printf("[AUTH] WARNING: JWT_SECRET is only %d bytes; use at least %d random bytes (startup fails with ENV=production).", len(cfg.JWTSecret), minJWTSecretLength)
+	}
+
+	apiKeys, err := loadAPIKeys(h.config.APIKeys, h.config.APIKeysFile)
+	if err != nil {
+		log.Fatalf("[AUTH] Failed to load API keys: %v", err)
+	}
+	h.apiKeys = apiKeys
+	if len(apiKeys) > 0 {
+		log.Printf("[AUTH] Loaded %d API keys", len(apiKeys))
+	}
+
+	if h.config.UsersFile != "" {
+		users, err := loadUserStore(h.config.UsersFile, h.config.AdminUser, h.config.AdminPass)
+		if err != nil {
+			log.Fatalf("[AUTH] Failed to load users file %s: %v", h.config.UsersFile, err)
+		}
+		h.users = users
+		log.Printf("[AUTH] Loaded users from %s", h.config.UsersFile)
+	}
+
+	return h
 }
 
 // LoginRequest represents the login payload.
@@ -51,15 +157,45 @@ type LoginResponse struct {
 	Token string `json:"token"`
 }
 
+// ValidateResponse describes the credentials a request was authenticated with.
+type ValidateResponse struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// ExpiresAt is omitted for API keys, which don't expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
 // Claims represents the JWT claims.
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role"`
 	jwt.RegisteredClaims
 }
 
+// ChangePasswordRequest represents the password change payload.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
 // RegisterRoutes registers the auth routes on the mux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/login", h.Login)
+	mux.HandleFunc("/api/password", h.Middleware(h.HandleChangePassword))
+	mux.HandleFunc("/api/validate", h.Middleware(h.HandleValidate))
+}
+
+// authenticate checks credentials against the users file when configured,
+// otherwise against the single admin account from the environment, and
+// returns the user's role.
+func (h *Handler) authenticate(username, password string) (string, bool) {
+	if h.users != nil {
+		u, ok := h.users.authenticate(username, password)
+		return u.Role, ok
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(h.config.AdminUser)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(h.config.AdminPass)) == 1
+	return RoleAdmin, userOK && passOK
 }
 
 // Login handles user authentication.
@@ -70,12 +206,12 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if !httpjson.Decode(w, r, &req) {
 		return
 	}
 
-	if req.Username != h.config.AdminUser || req.Password != h.config.AdminPass {
+	role, ok := h.authenticate(req.Username, req.Password)
+	if !ok {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
@@ -83,10 +219,14 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &Claims{
 		Username: req.Username,
+		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
+	if h.config.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{h.config.Audience}
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(h.config.JWTSecret)
@@ -99,9 +239,16 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(LoginResponse{Token: tokenString})
 }
 
-// Middleware protects routes requiring authentication.
+// Middleware protects routes requiring authentication. Requests carrying an
+// X-API-Key header are authenticated by key, all others by JWT bearer token.
 func (h *Handler) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	apiKeyAuth := h.APIKeyMiddleware(next)
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(APIKeyHeader) != "" {
+			apiKeyAuth(w, r)
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "Authorization header required", http.StatusUnauthorized)
@@ -117,13 +264,135 @@ func (h *Handler) Middleware(next http.HandlerFunc) http.HandlerFunc {
 		claims := &Claims{}
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 			return h.config.JWTSecret, nil
-		})
+		}, h.parserOptions()...)
 
 		if err != nil || !token.Valid {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		next(w, r)
+		next(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, claims)))
+	}
+}
+
+// RequireRole rejects authenticated requests whose role doesn't grant access with 403.
+// It must run inside Middleware so the claims are available.
+func (h *Handler) RequireRole(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !hasRole(claims.Role, role) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// WithRole combines Middleware and RequireRole for routes needing a specific role.
+func (h *Handler) WithRole(role string) func(http.HandlerFunc) http.HandlerFunc {
+	requireRole := h.RequireRole(role)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return h.Middleware(requireRole(next))
+	}
+}
+
+// parserOptions returns the validation options applied to every bearer token.
+func (h *Handler) parserOptions() []jwt.ParserOption {
+	// WithIssuedAt rejects tokens issued in the future, beyond the leeway.
+	opts := []jwt.ParserOption{jwt.WithLeeway(h.config.Leeway), jwt.WithIssuedAt()}
+	if h.config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(h.config.Audience))
 	}
+	return opts
+}
+
+// HasRole reports whether the claims grant access to routes needing role.
+func (c *Claims) HasRole(role string) bool {
+	return hasRole(c.Role, role)
+}
+
+func hasRole(have, want string) bool {
+	// A missing role grants nothing beyond authentication.
+	if have == RoleAdmin {
+		return true
+	}
+	return have != "" && have == want
+}
+
+// HandleValidate reports who the presented token or API key belongs to and
+// when it expires. Invalid credentials never get here: Middleware answers 401.
+func (h *Handler) HandleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp := ValidateResponse{Username: claims.Username, Role: claims.Role}
+	if claims.ExpiresAt != nil {
+		expires := claims.ExpiresAt.Time.UTC()
+		resp.ExpiresAt = &expires
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleChangePassword lets an authenticated user rotate their own password.
+func (h *Handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.users == nil {
+		http.Error(w, "Password changes require USERS_FILE to be configured", http.StatusNotImplemented)
+		return
+	}
+
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if !httpjson.Decode(w, r, &req) {
+		return
+	}
+
+	if _, ok := h.users.authenticate(claims.Username, req.CurrentPassword); !ok {
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	if len(req.NewPassword) < h.config.MinPasswordLength {
+		http.Error(w, fmt.Sprintf("New password must be at least %d characters", h.config.MinPasswordLength), http.StatusBadRequest)
+		return
+	}
+	if len(req.NewPassword) > maxPasswordLength {
+		http.Error(w, fmt.Sprintf("New password must be at most %d bytes", maxPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.users.setPassword(claims.Username, req.NewPassword); err != nil {
+		log.Printf("[AUTH] Failed to change password for %s: %v", claims.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[AUTH] Password changed for user %s", claims.Username)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "password changed"})
 }
@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// newTestHandler returns a handler backed by a users file seeded with admin/password1.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	return NewHandler(Config{
+		AdminUser:         "admin",
+		AdminPass:         "password1",
+		JWTSecret:         []byte(testSecret),
+		Leeway:            30 * time.Second,
+		UsersFile:         filepath.Join(t.TempDir(), "users.json"),
+		MinPasswordLength: 8,
+	})
+}
+
+// doJSON sends body as JSON to handler and returns the recorded response.
+func doJSON(handler http.HandlerFunc, method, token string, body any) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, "/", bytes.NewReader(data))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func login(t *testing.T, h *Handler, username, password string) string {
+	t.Helper()
+	rec := doJSON(h.Login, http.MethodPost, "", LoginRequest{Username: username, Password: password})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp LoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return resp.Token
+}
+
+// TestHandlerConcurrentRequests logs in, validates tokens and rotates the
+// password from several goroutines at once so `go test -race` sees the user
+// store shared between requests.
+func TestHandlerConcurrentRequests(t *testing.T) {
+	h := newTestHandler(t)
+	token := login(t, h, "admin", "password1")
+	validate := h.Middleware(h.HandleValidate)
+	changePassword := h.Middleware(h.HandleChangePassword)
+
+	const workers = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*3)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// Passwords change underneath the login, so either outcome is fine.
+			rec := doJSON(h.Login, http.MethodPost, "", LoginRequest{Username: "admin", Password: "password1"})
+			if rec.Code != http.StatusOK && rec.Code != http.StatusUnauthorized {
+				errs <- fmt.Errorf("login: status %d", rec.Code)
+			}
+
+			if rec := doJSON(validate, http.MethodGet, token, nil); rec.Code != http.StatusOK {
+				errs <- fmt.Errorf("validate: status %d", rec.Code)
+			}
+
+			// Rotations racing the first one may fail the current-password check.
+			rec = doJSON(changePassword, http.MethodPost, token, ChangePasswordRequest{
+				CurrentPassword: "password1",
+				NewPassword:     fmt.Sprintf("password1-%d", w),
+			})
+			if rec.Code != http.StatusOK && rec.Code != http.StatusUnauthorized {
+				errs <- fmt.Errorf("change password: status %d: %s", rec.Code, rec.Body)
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// The last rotation written wins, and the file on disk holds exactly it.
+	reloaded, err := loadUserStore(h.config.UsersFile, "admin", "unused")
+	if err != nil {
+		t.Fatalf("reload users file: %v", err)
+	}
+	matches := 0
+	for w := 0; w < workers; w++ {
+		if _, ok := reloaded.authenticate("admin", fmt.Sprintf("password1-%d", w)); ok {
+			matches++
+		}
+	}
+	if matches != 1 {
+		t.Errorf("%d rotated passwords are valid after reload, want 1", matches)
+	}
+}
+
+func TestJSONHandlersRejectUnknownFields(t *testing.T) {
+	h := newTestHandler(t)
+	token := login(t, h, "admin", "password1")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		token   string
+	}{
+		{name: "login", handler: h.Login},
+		{name: "change password", handler: h.Middleware(h.HandleChangePassword), token: token},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(tt.handler, http.MethodPost, tt.token, map[string]string{"username": "admin", "pasword": "typo"})
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), `unknown field "pasword"`) {
+				t.Errorf("body %q doesn't name the unknown field", rec.Body)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLeeway(t *testing.T) {
+	h := newTestHandler(t)
+	leeway := h.config.Leeway
+	// A margin well above test run time keeps "just inside" and "just outside" stable.
+	const margin = 5 * time.Second
+
+	tests := []struct {
+		name   string
+		claims jwt.RegisteredClaims
+		valid  bool
+	}{
+		{name: "expired within leeway", claims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-leeway + margin))}, valid: true},
+		{name: "expired beyond leeway", claims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-leeway - margin))}, valid: false},
+		{name: "not yet valid within leeway", claims: jwt.RegisteredClaims{NotBefore: jwt.NewNumericDate(time.Now().Add(leeway - margin))}, valid: true},
+		{name: "not yet valid beyond leeway", claims: jwt.RegisteredClaims{NotBefore: jwt.NewNumericDate(time.Now().Add(leeway + margin))}, valid: false},
+		{name: "issued in the future within leeway", claims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now().Add(leeway - margin))}, valid: true},
+		{name: "issued in the future beyond leeway", claims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now().Add(leeway + margin))}, valid: false},
+	}
+
+	validate := h.Middleware(h.HandleValidate)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &Claims{Username: "admin", Role: RoleAdmin, RegisteredClaims: tt.claims}
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := doJSON(validate, http.MethodGet, token, nil)
+			want := http.StatusUnauthorized
+			if tt.valid {
+				want = http.StatusOK
+			}
+			if rec.Code != want {
+				t.Errorf("status %d, want %d: %s", rec.Code, want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestMissingRoleDefaultsToReader(t *testing.T) {
+	dir := t.TempDir()
+	keysFile := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(keysFile, []byte(`[{"name":"file","key":"file-key"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersFile := filepath.Join(dir, "users.json")
+	users, _ := json.Marshal([]User{
+		{Username: "admin", PasswordHash: hash},
+		{Username: "alice", PasswordHash: hash},
+	})
+	if err := os.WriteFile(usersFile, users, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(Config{
+		AdminUser:         "admin",
+		AdminPass:         "password1",
+		JWTSecret:         []byte(testSecret),
+		UsersFile:         usersFile,
+		MinPasswordLength: 8,
+		APIKeys:           "env:env-key,ops:ops-key:admin",
+		APIKeysFile:       keysFile,
+	})
+	adminOnly := h.WithRole(RoleAdmin)(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{name: "api key without role", header: APIKeyHeader, value: "env-key", want: http.StatusForbidden},
+		{name: "api key file entry without role", header: APIKeyHeader, value: "file-key", want: http.StatusForbidden},
+		{name: "api key with admin role", header: APIKeyHeader, value: "ops-key", want: http.StatusOK},
+		{name: "user without role", header: "Authorization", value: "Bearer " + login(t, h, "alice", "password1"), want: http.StatusForbidden},
+		{name: "bootstrap admin without role", header: "Authorization", value: "Bearer " + login(t, h, "admin", "password1"), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/reset", nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			adminOnly(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		have, want string
+		ok         bool
+	}{
+		{have: RoleAdmin, want: RoleAdmin, ok: true},
+		{have: RoleAdmin, want: RoleReader, ok: true},
+		{have: RoleReader, want: RoleReader, ok: true},
+		{have: RoleReader, want: RoleAdmin, ok: false},
+		{have: "", want: RoleAdmin, ok: false},
+		{have: "", want: RoleReader, ok: false},
+	}
+	for _, tt := range tests {
+		if got := hasRole(tt.have, tt.want); got != tt.ok {
+			t.Errorf("hasRole(%q, %q) = %v, want %v", tt.have, tt.want, got, tt.ok)
+		}
+	}
+}
+
+func TestPasswordHashing(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		t.Errorf("hash %q is not a bcrypt hash: %v", hash, err)
+	}
+	if !verifyPassword(hash, "correct horse") {
+		t.Error("the hashed password doesn't verify")
+	}
+	if verifyPassword(hash, "wrong horse") {
+		t.Error("a different password verifies")
+	}
+	if verifyPassword("not a hash", "correct horse") {
+		t.Error("a malformed hash verifies")
+	}
+	if again, _ := hashPassword("correct horse"); again == hash {
+		t.Error("hashing the same password twice gave the same salt")
+	}
+}
+
+func TestUnknownUserCostsAPasswordCheck(t *testing.T) {
+	if cost, err := bcrypt.Cost([]byte(dummyPasswordHash)); err != nil || cost != bcrypt.DefaultCost {
+		t.Fatalf("dummy hash cost = %d (%v), want bcrypt.DefaultCost to match stored hashes", cost, err)
+	}
+
+	h := newTestHandler(t)
+	elapsed := func(username string) time.Duration {
+		start := time.Now()
+		if _, ok := h.authenticate(username, "wrong password"); ok {
+			t.Fatalf("%s authenticated with the wrong password", username)
+		}
+		return time.Since(start)
+	}
+	known, unknown := elapsed("admin"), elapsed("nobody")
+	// A bcrypt check takes milliseconds and a map miss microseconds, so a
+	// generous margin still tells them apart.
+	if unknown < known/4 {
+		t.Errorf("unknown user rejected in %s, known user in %s: timing reveals which usernames exist", unknown, known)
+	}
+}
+
+func TestChangePasswordTooLong(t *testing.T) {
+	h := newTestHandler(t)
+	token := login(t, h, "admin", "password1")
+
+	rec := doJSON(h.Middleware(h.HandleChangePassword), http.MethodPost, token, ChangePasswordRequest{
+		CurrentPassword: "password1",
+		NewPassword:     strings.Repeat("x", maxPasswordLength+1),
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", rec.Code, rec.Body)
+	}
+	// The old password still works.
+	login(t, h, "admin", "password1")
+}
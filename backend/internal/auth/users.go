@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength is the most bytes bcrypt hashes; longer passwords are rejected.
+const maxPasswordLength = 72
+
+// dummyPasswordHash is a bcrypt hash at bcrypt.DefaultCost that unknown
+// usernames are checked against, so a failed login takes as long whether or
+// not the account exists.
+const dummyPasswordHash = "$2a$10$63Zp15QZNk./tXbE28ww4eYL.LYtOEsyiGxjenBb5IR6AwetAtYmi"
+
+// ErrUserNotFound is returned when a username has no record in the store.
+var ErrUserNotFound = errors.New("user not found")
+
+// User is a single account persisted in the users file.
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	// Role defaults to RoleReader when omitted, except for the bootstrap admin.
+	Role string `json:"role,omitempty"`
+}
+
+// userStore keeps accounts in a JSON file. All writes go through mu so
+// concurrent password changes can't interleave and corrupt the file.
+type userStore struct {
+	path  string
+	mu    sync.Mutex
+	users map[string]User
+}
+
+// loadUserStore reads the users file at path. A missing file is seeded with
+// the given bootstrap admin so existing single-user setups keep working.
+func loadUserStore(path, adminUser, adminPass string) (*userStore, error) {
+	s := &userStore{path: path, users: make(map[string]User)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		hash, err := hashPassword(adminPass)
+		if err != nil {
+			return nil, err
+		}
+		s.users[adminUser] = User{Username: adminUser, PasswordHash: hash, Role: RoleAdmin}
+		return s, s.saveLocked()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse users file: %w", err)
+	}
+	for _, u := range users {
+		if u.Role == "" {
+			// Files written before roles existed only held the bootstrap admin.
+			u.Role = RoleReader
+			if u.Username == adminUser {
+				u.Role = RoleAdmin
+			}
+		}
+		s.users[u.Username] = u
+	}
+	return s, nil
+}
+
+// authenticate reports whether password matches the stored hash for username.
+func (s *userStore) authenticate(username, password string) (User, bool) {
+	s.mu.Lock()
+	u, ok := s.users[username]
+	s.mu.Unlock()
+	if !ok {
+		verifyPassword(dummyPasswordHash, password)
+		return User{}, false
+	}
+	return u, verifyPassword(u.PasswordHash, password)
+}
+
+// setPassword replaces the user's password hash and persists the file.
+func (s *userStore) setPassword(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.PasswordHash = hash
+	s.users[username] = u
+	return s.saveLocked()
+}
+
+// saveLocked writes the users file atomically. Callers must hold mu (or own s exclusively).
+func (s *userStore) saveLocked() error {
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".users-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// hashPassword returns the bcrypt hash of password.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// verifyPassword checks password against a bcrypt hash.
+func verifyPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
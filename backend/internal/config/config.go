@@ -0,0 +1,196 @@
+// Package config resolves service settings from the environment and an
+// optional JSON config file.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checker collects validation failures so they can all be reported at once.
+type Checker struct {
+	errs []error
+}
+
+// Check records a validation failure for key unless ok holds.
+func (c *Checker) Check(ok bool, key, format string, args ...interface{}) {
+	if !ok {
+		c.errs = append(c.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+}
+
+// CheckURL records a failure unless raw is an absolute http(s) URL. Empty
+// values pass when optional is set.
+func (c *Checker) CheckURL(key, raw string, optional bool) {
+	if raw == "" && optional {
+		return
+	}
+	u, err := url.Parse(raw)
+	c.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		key, "must be an http(s) URL, got %q", raw)
+}
+
+// Err returns every problem recorded so far, or nil.
+func (c *Checker) Err() error {
+	return errors.Join(c.errs...)
+}
+
+// Source looks settings up by their environment variable name. A value set in
+// the environment wins over the config file, which wins over the caller's
+// default. Malformed values are collected rather than returned one at a time,
+// so Err reports every problem at startup at once.
+type Source struct {
+	Checker
+	file map[string]string
+}
+
+// Load reads the JSON object at path, keyed by environment variable name, e.g.
+// {"OLLAMA_URL": "http://ollama:11434", "CHROMA_BATCH_SIZE": 32}. Strings,
+// numbers and booleans are used as-is, arrays are joined with commas and
+// objects are kept as JSON text. An empty path yields an environment-only Source.
+// YAML is not supported; a .yaml or .yml path is rejected rather than
+// misread as JSON.
+func Load(path string) (*Source, error) {
+	s := &Source{file: map[string]string{}}
+	if path == "" {
+		return s, nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("config file %s: YAML is not supported, write it as a JSON object keyed by variable name", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("config file %s must be a JSON object: %w", path, err)
+	}
+
+	for key, msg := range raw {
+		value, err := flatten(msg)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+		if value != nil {
+			s.file[key] = *value
+		}
+	}
+	return s, nil
+}
+
+// flatten converts a JSON value to the string form its environment variable would take.
+func flatten(msg json.RawMessage) (*string, error) {
+	msg = bytes.TrimSpace(msg)
+	var out string
+	switch {
+	case bytes.Equal(msg, []byte("null")):
+		return nil, nil
+	case len(msg) > 0 && msg[0] == '"':
+		if err := json.Unmarshal(msg, &out); err != nil {
+			return nil, err
+		}
+	case len(msg) > 0 && msg[0] == '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(msg, &items); err != nil {
+			return nil, err
+		}
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			v, err := flatten(item)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				parts = append(parts, *v)
+			}
+		}
+		out = strings.Join(parts, ",")
+	default:
+		// Numbers, booleans and objects keep their literal JSON text.
+		out = string(msg)
+	}
+	return &out, nil
+}
+
+func (s *Source) lookup(key string) (string, bool) {
+	if value := os.Getenv(key); value != "" {
+		return value, true
+	}
+	value, ok := s.file[key]
+	return value, ok && value != ""
+}
+
+// String returns the setting for key, or defaultValue if unset.
+func (s *Source) String(key, defaultValue string) string {
+	if value, ok := s.lookup(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// Int returns the integer setting for key.
+func (s *Source) Int(key string, defaultValue int) int {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: invalid integer %q", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// Float returns the floating-point setting for key.
+func (s *Source) Float(key string, defaultValue float64) float64 {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: invalid number %q", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// Duration returns the duration setting for key, written like "30s" or "2m".
+func (s *Source) Duration(key string, defaultValue time.Duration) time.Duration {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: invalid duration %q", key, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// Bool returns the boolean setting for key ("true"/"false", "1"/"0", ...).
+func (s *Source) Bool(key string, defaultValue bool) bool {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: invalid boolean %q", key, value))
+		return defaultValue
+	}
+	return parsed
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("json", func(t *testing.T) {
+		t.Setenv("CHROMA_BATCH_SIZE", "")
+		src, err := Load(write("config.json", `{"EMBEDDING_MODELS": ["a", "b"], "CHROMA_BATCH_SIZE": 32, "EMBED_OPTIONS": {"num_ctx": 8192}, "UNSET": null}`))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if got := src.String("EMBEDDING_MODELS", ""); got != "a,b" {
+			t.Errorf("EMBEDDING_MODELS = %q, want a,b", got)
+		}
+		if got := src.Int("CHROMA_BATCH_SIZE", 0); got != 32 {
+			t.Errorf("CHROMA_BATCH_SIZE = %d, want 32", got)
+		}
+		if got := src.String("EMBED_OPTIONS", ""); got != `{"num_ctx": 8192}` {
+			t.Errorf("EMBED_OPTIONS = %q, want the object's JSON text", got)
+		}
+		if got := src.String("UNSET", "default"); got != "default" {
+			t.Errorf("UNSET = %q, want the default", got)
+		}
+		if err := src.Err(); err != nil {
+			t.Errorf("Err: %v", err)
+		}
+	})
+
+	t.Run("environment wins", func(t *testing.T) {
+		t.Setenv("CHROMA_BATCH_SIZE", "8")
+		src, err := Load(write("env.json", `{"CHROMA_BATCH_SIZE": 32}`))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if got := src.Int("CHROMA_BATCH_SIZE", 0); got != 8 {
+			t.Errorf("CHROMA_BATCH_SIZE = %d, want the environment's 8", got)
+		}
+	})
+
+	for _, name := range []string{"config.yaml", "config.YML"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(write(name, "CHROMA_BATCH_SIZE: 32\n"))
+			if err == nil || !strings.Contains(err.Error(), "YAML is not supported") {
+				t.Errorf("Load error = %v, want YAML rejected", err)
+			}
+		})
+	}
+
+	t.Run("not an object", func(t *testing.T) {
+		if _, err := Load(write("list.json", `["OLLAMA_URL"]`)); err == nil {
+			t.Error("Load accepted a JSON array")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// errDocumentNotFound is returned when appendTo names a document with no stored chunks.
+var errDocumentNotFound = errors.New("document not found")
+
+// storedDocument describes a document already in a collection.
+type storedDocument struct {
+	filename string
+	path     string
+	// lastChunk is the highest chunk_num stored for the document.
+	lastChunk int
+}
+
+// findStoredDocument looks up documentID so that appended chunks can keep
+// its filename and path and continue its chunk sequence.
+func (h *Handler) findStoredDocument(collection, documentID string) (*storedDocument, error) {
+	colID, err := h.findCollection(collection)
+	if err != nil {
+		if errors.Is(err, ErrCollectionNotFound) {
+			return nil, fmt.Errorf("%w: %s", errDocumentNotFound, documentID)
+		}
+		return nil, err
+	}
+
+	getURL := fmt.Sprintf("%s%s/%s/get", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"where":   map[string]interface{}{"document_id": documentID},
+		"include": []string{"metadatas"},
+	})
+
+	resp, err := h.storeClient.Post(getURL, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to POST to %s: %w", getURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("chroma get returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var data struct {
+		Metadatas []map[string]interface{} `json:"metadatas"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode chroma get response: %w", err)
+	}
+	if len(data.Metadatas) == 0 {
+		return nil, fmt.Errorf("%w: %s", errDocumentNotFound, documentID)
+	}
+
+	doc := &storedDocument{}
+	for _, meta := range data.Metadatas {
+		if n := metadataInt(meta, "chunk_num"); n > doc.lastChunk {
+			doc.lastChunk = n
+		}
+		if doc.filename == "" {
+			doc.filename, _ = meta["filename"].(string)
+		}
+		if doc.path == "" {
+			doc.path, _ = meta["path"].(string)
+		}
+	}
+	return doc, nil
+}
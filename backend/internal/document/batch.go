@@ -0,0 +1,109 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/akhilmk/gowise/internal/httpjson"
+)
+
+const maxBatchQueries = 100
+
+// BatchSearchRequest is the payload for HandleBatchSearch.
+type BatchSearchRequest struct {
+	Queries []string `json:"queries"`
+	K       int      `json:"k"`
+}
+
+// BatchSearchResponse holds one result set per input query, in input order.
+type BatchSearchResponse struct {
+	Results []SearchResponse `json:"results"`
+}
+
+// HandleBatchSearch runs many queries with one batched embedding call and one Chroma query.
+func (h *Handler) HandleBatchSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BatchSearchRequest
+	if !httpjson.Decode(w, r, &req) {
+		return
+	}
+	if len(req.Queries) == 0 {
+		http.Error(w, "Field 'queries' must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Queries) > maxBatchQueries {
+		http.Error(w, fmt.Sprintf("At most %d queries per batch", maxBatchQueries), http.StatusBadRequest)
+		return
+	}
+	collection, err := h.requestCollection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Queries that embedQuery would embed alike are searched once.
+	prepared := make([]string, len(req.Queries))
+	for i, q := range req.Queries {
+		prepared[i] = h.prepareQuery(q)
+		if strings.TrimSpace(prepared[i]) == "" {
+			http.Error(w, fmt.Sprintf("Query %d is empty", i), http.StatusBadRequest)
+			return
+		}
+	}
+	topK := req.K
+	if topK <= 0 || topK > maxTopK {
+		topK = defaultTopK
+	}
+	if !h.chargeQuota(w, r, quotaSearch, len(req.Queries)) {
+		return
+	}
+
+	// A full batch of queries outlives the server write timeout.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[BATCH SEARCH WARNING] Could not clear write deadline: %v", err)
+	}
+
+	// Evaluation sets often repeat queries; embed and search each distinct
+	// query once and fan the results back out to every position.
+	unique := make([]string, 0, len(req.Queries))
+	slot := make([]int, len(req.Queries))
+	seen := make(map[string]int, len(req.Queries))
+	for i, p := range prepared {
+		idx, ok := seen[p]
+		if !ok {
+			idx = len(unique)
+			seen[p] = idx
+			unique = append(unique, req.Queries[i])
+		}
+		slot[i] = idx
+	}
+
+	log.Printf("Batch searching %d queries in %s (%d unique, k=%d)", len(req.Queries), collection, len(unique), topK)
+
+	embeddings, err := h.embedQueries(r.Context(), unique, h.config.DefaultModel)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get embeddings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	res, err := h.queryChromaMulti(r.Context(), collection, embeddings, topK, false, nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to query chroma: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	out := BatchSearchResponse{Results: make([]SearchResponse, len(req.Queries))}
+	for i, q := range req.Queries {
+		out.Results[i] = SearchResponse{Query: q, Results: toSearchResults(res, slot[i], collection, h.score)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,168 @@
+package document
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// boostRule multiplies the relevance of hits whose metadata key has value.
+type boostRule struct {
+	key    string
+	value  string
+	factor float64
+}
+
+// parseBoostRules reads "key=value:factor" rules, comma-separated, e.g.
+// "tags=urgent:1.5,type=table:0.8".
+func parseBoostRules(spec string) ([]boostRule, error) {
+	var rules []boostRule
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		rule, err := parseBoostRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseBoostRule(entry string) (boostRule, error) {
+	match, factorStr, ok := strings.Cut(entry, ":")
+	key, value, okEq := strings.Cut(match, "=")
+	if !ok || !okEq || key == "" || value == "" {
+		return boostRule{}, fmt.Errorf("invalid boost %q (want key=value:factor)", entry)
+	}
+	factor, err := strconv.ParseFloat(factorStr, 64)
+	if err != nil || factor < 0 {
+		return boostRule{}, fmt.Errorf("invalid boost factor in %q", entry)
+	}
+	return boostRule{key: key, value: value, factor: factor}, nil
+}
+
+// matches reports whether meta[r.key] is r.value or, for a comma-separated
+// string such as tags, contains it as one of its items.
+func (r boostRule) matches(meta map[string]interface{}) bool {
+	v, ok := meta[r.key]
+	if !ok {
+		return false
+	}
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Sprint(v) == r.value
+	}
+	if s == r.value {
+		return true
+	}
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == r.value {
+			return true
+		}
+	}
+	return false
+}
+
+// searchBoost adjusts relevance by metadata: every matching rule multiplies
+// it, and with a half-life set it also decays with the chunk's age, keeping
+// at least 1-recencyWeight of it.
+type searchBoost struct {
+	rules         []boostRule
+	halfLife      time.Duration
+	recencyWeight float64
+}
+
+func (b searchBoost) enabled() bool {
+	return len(b.rules) > 0 || b.halfLife > 0
+}
+
+// factor returns the multiplier for a hit with the given metadata at now.
+// Chunks without ingested_at_unix get no recency adjustment.
+func (b searchBoost) factor(meta map[string]interface{}, now time.Time) float64 {
+	f := 1.0
+	for _, r := range b.rules {
+		if r.matches(meta) {
+			f *= r.factor
+		}
+	}
+	if b.halfLife > 0 {
+		if ts, ok := meta[ingestedAtUnixKey].(float64); ok {
+			age := now.Sub(time.Unix(int64(ts), 0))
+			if age < 0 {
+				age = 0
+			}
+			decay := math.Pow(0.5, age.Hours()/b.halfLife.Hours())
+			f *= 1 - b.recencyWeight + b.recencyWeight*decay
+		}
+	}
+	return f
+}
+
+// apply multiplies each result's relevance by its boost factor, recording
+// the factor in Boost and the product in BoostedScore, and re-sorts the
+// results by it. Relevance is the rerank score for reranked results and
+// otherwise 1/(1+distance): Score may be negative (SCORE_FUNCTION=linear
+// with distances over the scale), and a factor above 1 must never rank a hit
+// lower. It runs after reranking so the boost refines that order rather
+// than being discarded by it.
+func (b searchBoost) apply(results []SearchResult) {
+	now := time.Now()
+	for i := range results {
+		f := b.factor(results[i].Metadata, now)
+		boosted := relevance(results[i]) * f
+		boost := float32(f)
+		results[i].Boost = &boost
+		results[i].BoostedScore = &boosted
+	}
+	sort.SliceStable(results, func(i, j int) bool { return *results[i].BoostedScore > *results[j].BoostedScore })
+}
+
+// relevance is the non-negative similarity a boost scales: the reranker's
+// relevance score (0 to 1 for Cohere/Jina-style rerankers) when reranked,
+// or 1/(1+distance), which orders like the distance.
+func relevance(res SearchResult) float64 {
+	if res.RerankScore != nil {
+		return math.Max(*res.RerankScore, 0)
+	}
+	return 1 / (1 + math.Max(float64(res.Distance), 0))
+}
+
+// requestBoost combines the configured boost with the request's overrides:
+// boost params (repeatable, key=value:factor) replace BOOST_METADATA, and
+// recencyHalfLife / recencyWeight replace the recency settings
+// ("recencyHalfLife=0" turns recency off).
+func (h *Handler) requestBoost(q url.Values) (searchBoost, error) {
+	b := searchBoost{rules: h.config.BoostRules, halfLife: h.config.BoostHalfLife, recencyWeight: h.config.BoostRecencyWeight}
+	if specs := q["boost"]; len(specs) > 0 {
+		b.rules = nil
+		for _, spec := range specs {
+			rules, err := parseBoostRules(spec)
+			if err != nil {
+				return b, err
+			}
+			b.rules = append(b.rules, rules...)
+		}
+	}
+	if v := q.Get("recencyHalfLife"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return b, fmt.Errorf("invalid recencyHalfLife %q (want a duration such as 720h)", v)
+		}
+		b.halfLife = d
+	}
+	if v := q.Get("recencyWeight"); v != "" {
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil || w < 0 || w > 1 {
+			return b, fmt.Errorf("invalid recencyWeight %q (want 0 to 1)", v)
+		}
+		b.recencyWeight = w
+	}
+	return b, nil
+}
@@ -0,0 +1,78 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// sendChromaAdd posts req to Chroma's add endpoint at url, splitting it in
+// half (recursively) when its body exceeds CHROMA_MAX_ADD_BYTES or Chroma
+// rejects it as too large. It returns how many records were stored; the
+// halves are sent in order and the first failure stops the rest, so on
+// error the stored records are always a prefix of req.
+func (h *Handler) sendChromaAdd(url string, req ChromaAddRequest) (int, error) {
+	n := len(req.Ids)
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode add request: %w", err)
+	}
+	if n > 1 && h.config.ChromaMaxAddBytes > 0 && int64(len(reqBody)) > h.config.ChromaMaxAddBytes {
+		log.Printf("[CHROMA ADD] Splitting %d records (%d bytes > CHROMA_MAX_ADD_BYTES %d)", n, len(reqBody), h.config.ChromaMaxAddBytes)
+		return h.sendChromaAddSplit(url, req)
+	}
+
+	resp, err := h.storeClient.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, fmt.Errorf("http post to %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		if n > 1 && addTooLarge(resp.StatusCode, body) {
+			log.Printf("[CHROMA ADD] Chroma rejected %d records (%d bytes) as too large; splitting", n, len(reqBody))
+			return h.sendChromaAddSplit(url, req)
+		}
+		return 0, fmt.Errorf("chroma add returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return n, nil
+}
+
+func (h *Handler) sendChromaAddSplit(url string, req ChromaAddRequest) (int, error) {
+	mid := len(req.Ids) / 2
+	stored, err := h.sendChromaAdd(url, req.slice(0, mid))
+	if err != nil {
+		return stored, err
+	}
+	rest, err := h.sendChromaAdd(url, req.slice(mid, len(req.Ids)))
+	return stored + rest, err
+}
+
+// slice returns the records in [i, j) of the request.
+func (r ChromaAddRequest) slice(i, j int) ChromaAddRequest {
+	return ChromaAddRequest{
+		Documents:  r.Documents[i:j],
+		Metadatas:  r.Metadatas[i:j],
+		Ids:        r.Ids[i:j],
+		Embeddings: r.Embeddings[i:j],
+	}
+}
+
+// addTooLarge reports whether a failed add was rejected for its size: a 413
+// from Chroma or a proxy in front of it, or Chroma's batch size limit error
+// (reported as a 4xx or, by some versions, a 500).
+func addTooLarge(status int, body []byte) bool {
+	if status == http.StatusRequestEntityTooLarge {
+		return true
+	}
+	if status < 400 || status >= 500 && status != http.StatusInternalServerError {
+		return false
+	}
+	msg := strings.ToLower(string(body))
+	return strings.Contains(msg, "too large") || strings.Contains(msg, "batch size") || strings.Contains(msg, "cannot submit more than")
+}
@@ -0,0 +1,77 @@
+package document
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ChunkContextData is the data passed to CHUNK_CONTEXT_TEMPLATE for every chunk.
+type ChunkContextData struct {
+	Filename string
+	Title    string
+	Path     string
+	Page     int
+	Text     string
+}
+
+// parseChunkContextTemplate parses CHUNK_CONTEXT_TEMPLATE and test-renders it
+// so mistakes surface at startup. An empty template disables contextual
+// chunking and returns nil.
+func parseChunkContextTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("chunk-context").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+	sample := ChunkContextData{Filename: "sample.pdf", Title: "Sample", Path: "docs", Page: 1, Text: "sample chunk"}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("failed to render: %w", err)
+	}
+	return tmpl, nil
+}
+
+// embedText returns the text embedded for a chunk: the chunk rendered through
+// the chunk context template, or the chunk itself when none is configured.
+// Chroma always stores the clean chunk text.
+func (h *Handler) embedText(doc ingestDoc, title string, page int, text string) string {
+	if h.chunkContext == nil {
+		return text
+	}
+	if title == "" {
+		title = strings.TrimSuffix(doc.filename, filepath.Ext(doc.filename))
+	}
+	var b strings.Builder
+	err := h.chunkContext.Execute(&b, ChunkContextData{
+		Filename: doc.filename,
+		Title:    title,
+		Path:     doc.path,
+		Page:     page,
+		Text:     text,
+	})
+	if err != nil {
+		return text
+	}
+	return b.String()
+}
+
+// markdownTitle returns the text of a leading "# " heading, skipping blank lines.
+func markdownTitle(text string) string {
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(line[2:])
+		}
+		return ""
+	}
+	return ""
+}
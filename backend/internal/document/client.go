@@ -0,0 +1,41 @@
+package document
+
+import (
+	"net/http"
+	"time"
+)
+
+// userAgentTransport stamps every outbound request with the configured User-Agent
+// so Ollama, Chroma and reranker logs can attribute traffic to this service.
+type userAgentTransport struct {
+	userAgent string
+	base      http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// newTransport builds the transport shared by all outbound clients, so
+// connections are pooled across them. http.DefaultTransport keeps only 2
+// idle connections per host, which makes concurrent embedding and storage
+// calls keep reconnecting; the HTTP_* settings raise that.
+func newTransport(cfg Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = cfg.HTTPMaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.HTTPMaxIdleConnsPerHost
+	t.MaxConnsPerHost = cfg.HTTPMaxConnsPerHost
+	t.IdleConnTimeout = cfg.HTTPIdleConnTimeout
+	return t
+}
+
+// newHTTPClient builds an outbound client over base; timeout 0 means no overall limit.
+func newHTTPClient(userAgent string, timeout time.Duration, base http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: &userAgentTransport{userAgent: userAgent, base: base},
+		Timeout:   timeout,
+	}
+}
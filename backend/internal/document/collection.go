@@ -0,0 +1,69 @@
+package document
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ChromaDB collection names must be 3-63 characters of [a-zA-Z0-9._-],
+// start and end with an alphanumeric, contain no "..", and not be an IPv4 address.
+const (
+	minCollectionName = 3
+	maxCollectionName = 63
+)
+
+var (
+	collectionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*[a-zA-Z0-9]$`)
+	collectionInvalidRun  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// validCollectionName reports whether name is acceptable to ChromaDB.
+func validCollectionName(name string) bool {
+	return len(name) >= minCollectionName && len(name) <= maxCollectionName &&
+		collectionNamePattern.MatchString(name) &&
+		!strings.Contains(name, "..") &&
+		net.ParseIP(name) == nil
+}
+
+// requestCollection returns the collection named by the request's
+// "collection" query parameter, or the configured default.
+func (h *Handler) requestCollection(r *http.Request) (string, error) {
+	name := r.URL.Query().Get("collection")
+	if name == "" {
+		return h.config.Collection, nil
+	}
+	if !validCollectionName(name) || !validCollectionName(h.config.chromaName(name)) {
+		return "", fmt.Errorf("invalid collection name %q", name)
+	}
+	return name, nil
+}
+
+// namespaceSeparator joins COLLECTION_NAMESPACE and a collection name in Chroma.
+const namespaceSeparator = "__"
+
+// chromaName maps an API-facing collection name to the name it is stored
+// under in Chroma, e.g. "documents" -> "tenantA__documents". Collection names
+// in requests, responses and logs are always the unprefixed ones.
+func (c Config) chromaName(name string) string {
+	if c.CollectionNamespace == "" {
+		return name
+	}
+	return c.CollectionNamespace + namespaceSeparator + name
+}
+
+// collectionForFile derives a per-document collection name from an uploaded
+// filename, e.g. "Q1 Report (final).pdf" -> "file-q1-report-final", at most
+// maxLen bytes long.
+func collectionForFile(filename string, maxLen int) string {
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	slug := strings.Trim(collectionInvalidRun.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	name := "file-" + slug
+	if len(name) > maxLen {
+		name = strings.TrimRight(name[:maxLen], "-")
+	}
+	return strings.TrimRight(name, "-")
+}
@@ -0,0 +1,20 @@
+package document
+
+import (
+	"log"
+	"net/http"
+)
+
+// HandleCompact is the maintenance hook for compacting the active collection.
+// Chroma's v2 API (the version this service targets) has no compaction or
+// optimize operation: the local segment store compacts its write-ahead log
+// on its own. The endpoint therefore reports 501 rather than pretending to work.
+func (h *Handler) HandleCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("[COMPACT] Requested for collection %s, but ChromaDB exposes no compaction API", h.config.Collection)
+	http.Error(w, "Compaction is not supported: the configured ChromaDB v2 API has no compact/optimize operation (ChromaDB compacts collections automatically)", http.StatusNotImplemented)
+}
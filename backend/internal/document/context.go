@@ -0,0 +1,88 @@
+package document
+
+import (
+	"sort"
+	"strings"
+)
+
+// minOverlapWords is the shortest word run treated as duplicated overlap
+// between two chunks rather than coincidental repetition.
+const minOverlapWords = 5
+
+// estimateTokens approximates a token count using the common ~4 characters per token rule.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// assembleContext picks which retrieved chunks go into the prompt. Chunks are
+// considered best score first; text overlapping an already-chosen chunk from the
+// same file (the stride overlap) is trimmed, and chunks that no longer fit in
+// budget tokens are dropped. A budget of 0 disables the limit.
+func assembleContext(sources []SearchResult, budget int) []SearchResult {
+	ordered := make([]SearchResult, len(sources))
+	copy(ordered, sources)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Score > ordered[j].Score
+	})
+
+	packed := make([]SearchResult, 0, len(ordered))
+	used := 0
+	for _, src := range ordered {
+		filename, _ := src.Metadata["filename"].(string)
+		text := src.Document
+		for _, chosen := range packed {
+			if chosenFile, _ := chosen.Metadata["filename"].(string); chosenFile != filename {
+				continue
+			}
+			text = trimOverlap(chosen.Document, text)
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		tokens := estimateTokens(text)
+		if budget > 0 && used+tokens > budget {
+			continue
+		}
+		used += tokens
+		src.Document = text
+		packed = append(packed, src)
+	}
+	return packed
+}
+
+// trimOverlap removes from next any leading words that repeat the end of prev,
+// or trailing words that repeat the start of prev. If next is wholly contained
+// in prev it returns "".
+func trimOverlap(prev, next string) string {
+	if strings.Contains(prev, next) {
+		return ""
+	}
+	a, b := strings.Fields(prev), strings.Fields(next)
+
+	for k := min(len(a), len(b)); k >= minOverlapWords; k-- {
+		if equalWords(a[len(a)-k:], b[:k]) {
+			b = b[k:]
+			break
+		}
+	}
+	for k := min(len(a), len(b)); k >= minOverlapWords; k-- {
+		if equalWords(b[len(b)-k:], a[:k]) {
+			b = b[:len(b)-k]
+			break
+		}
+	}
+	return strings.Join(b, " ")
+}
+
+func equalWords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
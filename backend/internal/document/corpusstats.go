@@ -0,0 +1,210 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultCorpusStatsLimit = 100
+	maxCorpusStatsLimit     = 1000
+)
+
+// corpusStatsKeys are the metadata fields whose values are tallied into
+// CorpusStatsResponse.Distributions. Values of "tags" are comma-separated.
+var corpusStatsKeys = []string{"type", "tags"}
+
+// DocumentStats summarises the chunks stored for one document.
+type DocumentStats struct {
+	DocumentID     string  `json:"documentId,omitempty"`
+	Filename       string  `json:"filename"`
+	Chunks         int     `json:"chunks"`
+	AvgChunkLength float64 `json:"avgChunkLength"`
+}
+
+// HistogramBucket counts the documents with between Min and Max chunks.
+type HistogramBucket struct {
+	Min       int `json:"min"`
+	Max       int `json:"max"`
+	Documents int `json:"documents"`
+}
+
+type CorpusStatsResponse struct {
+	Collection     string  `json:"collection"`
+	TotalVectors   int     `json:"totalVectors"`
+	TotalDocuments int     `json:"totalDocuments"`
+	AvgChunkLength float64 `json:"avgChunkLength"`
+	// Histogram buckets documents by chunk count in powers of two.
+	Histogram     []HistogramBucket         `json:"histogram"`
+	Distributions map[string]map[string]int `json:"distributions"`
+	// Documents is one page of the per-document counts, largest first.
+	Documents []DocumentStats `json:"documents"`
+	Offset    int             `json:"offset"`
+	Limit     int             `json:"limit"`
+}
+
+// HandleCorpusStats aggregates the stored metadata of a collection into
+// per-document chunk counts, a chunk-count histogram and the distribution of
+// chunk types and tags. The per-document list is paged with
+// limit and offset; the totals always cover the whole collection.
+func (h *Handler) HandleCorpusStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultCorpusStatsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxCorpusStatsLimit {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+	collection, err := h.requestCollection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	colID, err := h.collectionID(collection)
+	if err != nil {
+		http.Error(w, err.Error(), collectionErrorStatus(err))
+		return
+	}
+
+	// Paging through a large collection outlives the server write timeout.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[CORPUS STATS WARNING] Could not clear write deadline: %v", err)
+	}
+
+	type docTotals struct {
+		stats  DocumentStats
+		length int
+	}
+	docs := make(map[string]*docTotals)
+	distributions := make(map[string]map[string]int, len(corpusStatsKeys))
+	for _, key := range corpusStatsKeys {
+		distributions[key] = make(map[string]int)
+	}
+	vectors, totalLength := 0, 0
+
+	err = h.iterateCollection(colID, exportPageSize, []string{"documents", "metadatas"}, func(page *ChromaGetRecordsResponse) error {
+		for i := range page.Ids {
+			var meta map[string]interface{}
+			if i < len(page.Metadatas) {
+				meta = page.Metadatas[i]
+			}
+			length := 0
+			if i < len(page.Documents) {
+				length = utf8.RuneCountInString(page.Documents[i])
+			}
+			vectors++
+			totalLength += length
+
+			filename, _ := meta["filename"].(string)
+			documentID, _ := meta["document_id"].(string)
+			key := documentID
+			if key == "" {
+				key = "file:" + filename
+			}
+			d := docs[key]
+			if d == nil {
+				d = &docTotals{stats: DocumentStats{DocumentID: documentID, Filename: filename}}
+				docs[key] = d
+			}
+			d.stats.Chunks++
+			d.length += length
+
+			for _, field := range corpusStatsKeys {
+				value, ok := meta[field].(string)
+				if !ok || value == "" {
+					continue
+				}
+				if field != "tags" {
+					distributions[field][value]++
+					continue
+				}
+				for _, tag := range strings.Split(value, ",") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						distributions[field][tag]++
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[CORPUS STATS ERROR] %v", err)
+		http.Error(w, fmt.Sprintf("failed to read collection: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	all := make([]DocumentStats, 0, len(docs))
+	for _, d := range docs {
+		d.stats.AvgChunkLength = float64(d.length) / float64(d.stats.Chunks)
+		all = append(all, d.stats)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Chunks != all[j].Chunks {
+			return all[i].Chunks > all[j].Chunks
+		}
+		if all[i].Filename != all[j].Filename {
+			return all[i].Filename < all[j].Filename
+		}
+		return all[i].DocumentID < all[j].DocumentID
+	})
+
+	resp := CorpusStatsResponse{
+		Collection:     collection,
+		TotalVectors:   vectors,
+		TotalDocuments: len(all),
+		Histogram:      chunkHistogram(all),
+		Distributions:  distributions,
+		Documents:      []DocumentStats{},
+		Offset:         offset,
+		Limit:          limit,
+	}
+	if vectors > 0 {
+		resp.AvgChunkLength = float64(totalLength) / float64(vectors)
+	}
+	if offset < len(all) {
+		end := min(offset+limit, len(all))
+		resp.Documents = all[offset:end]
+	}
+
+	log.Printf("[CORPUS STATS] %s: %d vectors across %d documents", collection, vectors, len(all))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// chunkHistogram buckets documents by chunk count: 1, 2-3, 4-7, 8-15, ...
+// up to the bucket holding the largest document. Empty buckets in between
+// are kept so the histogram can be plotted as is.
+func chunkHistogram(docs []DocumentStats) []HistogramBucket {
+	buckets := []HistogramBucket{}
+	for _, d := range docs {
+		if d.Chunks < 1 {
+			continue
+		}
+		b := bits.Len(uint(d.Chunks)) - 1
+		for len(buckets) <= b {
+			lo := 1 << len(buckets)
+			buckets = append(buckets, HistogramBucket{Min: lo, Max: 2*lo - 1})
+		}
+		buckets[b].Documents++
+	}
+	return buckets
+}
@@ -0,0 +1,129 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/akhilmk/gowise/internal/httpjson"
+)
+
+// EmbedRequest is the payload for HandleEmbed.
+type EmbedRequest struct {
+	Text  string `json:"text"`
+	Model string `json:"model"`
+	// Purpose selects the configured prefix: "document" (default) or "query".
+	Purpose string `json:"purpose"`
+}
+
+// EmbedResponse returns the raw vector along with its dimension and L2 norm.
+type EmbedResponse struct {
+	Model     string    `json:"model"`
+	Dimension int       `json:"dimension"`
+	Norm      float64   `json:"norm"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// HandleEmbed returns the embedding of an arbitrary string for debugging retrieval quality.
+func (h *Handler) HandleEmbed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EmbedRequest
+	if !httpjson.Decode(w, r, &req) {
+		return
+	}
+	if req.Text == "" {
+		http.Error(w, "Missing field 'text'", http.StatusBadRequest)
+		return
+	}
+	if req.Model == "" {
+		req.Model = h.config.DefaultModel
+	}
+
+	purpose := purposeDocument
+	switch req.Purpose {
+	case "", "document":
+	case "query":
+		purpose = purposeQuery
+	default:
+		http.Error(w, "Field 'purpose' must be 'document' or 'query'", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Embedding %d chars with model %s", len(req.Text), req.Model)
+
+	embedding, err := h.getEmbedding(r.Context(), req.Text, req.Model, purpose)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get embedding: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EmbedResponse{
+		Model:     req.Model,
+		Dimension: len(embedding),
+		Norm:      l2Norm(embedding),
+		Embedding: embedding,
+	})
+}
+
+// CompareRequest is the payload for HandleCompare.
+type CompareRequest struct {
+	A     string `json:"a"`
+	B     string `json:"b"`
+	Model string `json:"model"`
+}
+
+// CompareResponse reports the cosine similarity between two embedded texts.
+type CompareResponse struct {
+	Model      string  `json:"model"`
+	Similarity float64 `json:"similarity"`
+}
+
+// HandleCompare embeds two texts and returns their cosine similarity.
+func (h *Handler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CompareRequest
+	if !httpjson.Decode(w, r, &req) {
+		return
+	}
+	if req.A == "" || req.B == "" {
+		http.Error(w, "Fields 'a' and 'b' are required", http.StatusBadRequest)
+		return
+	}
+	if !h.chargeQuota(w, r, quotaSearch, 2) {
+		return
+	}
+	if req.Model == "" {
+		req.Model = h.config.DefaultModel
+	}
+
+	a, err := h.embedDocument(r.Context(), req.A, req.Model)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to embed 'a': %v", err), http.StatusInternalServerError)
+		return
+	}
+	b, err := h.embedDocument(r.Context(), req.B, req.Model)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to embed 'b': %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(a) != len(b) {
+		http.Error(w, fmt.Sprintf("embedding dimensions differ: %d vs %d", len(a), len(b)), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CompareResponse{
+		Model:      req.Model,
+		Similarity: cosineSimilarity(a, b),
+	})
+}
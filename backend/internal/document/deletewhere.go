@@ -0,0 +1,106 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/akhilmk/gowise/internal/httpjson"
+)
+
+// DeleteWhereRequest is the body of POST /api/delete.
+type DeleteWhereRequest struct {
+	// Where is a Chroma metadata filter, e.g. {"filename": "old.pdf"} or
+	// {"$and": [{"source": "pdf"}, {"page": {"$gt": 10}}]}.
+	Where map[string]interface{} `json:"where"`
+}
+
+// HandleDeleteWhere deletes every chunk whose metadata matches a filter and
+// reports how many were removed. It requires ?confirm=true, and an empty
+// filter is refused; /api/reset is the way to clear a whole collection.
+//
+// The matching IDs are listed first and then deleted by ID, so the count is
+// exact even though Chroma's delete doesn't report one; chunks that start
+// matching while the delete runs are left alone.
+func (h *Handler) HandleDeleteWhere(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DeleteWhereRequest
+	if !httpjson.Decode(w, r, &req) {
+		return
+	}
+	if len(req.Where) == 0 {
+		http.Error(w, "Invalid request: where must be a non-empty metadata filter", http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("confirm") != "true" {
+		http.Error(w, "Bulk delete requires ?confirm=true", http.StatusBadRequest)
+		return
+	}
+	collection, err := h.requestCollection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	colID, err := h.findCollection(collection)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get collection: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	matched, err := h.chromaGet(colID, map[string]interface{}{
+		"where":   req.Where,
+		"include": []string{},
+	})
+	if err != nil {
+		// Chroma answers malformed filters with 400 or 422, which surface here.
+		http.Error(w, fmt.Sprintf("failed to find matching chunks: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	deleted := 0
+	for start := 0; start < len(matched.Ids); start += idPageSize {
+		ids := matched.Ids[start:min(start+idPageSize, len(matched.Ids))]
+		if err := h.deleteIDs(colID, ids); err != nil {
+			log.Printf("[DELETE WHERE ERROR] Collection: %s | Deleted %d/%d before failing: %v", collection, deleted, len(matched.Ids), err)
+			http.Error(w, fmt.Sprintf("deleted %d of %d matching chunks before failing: %v", deleted, len(matched.Ids), err), http.StatusBadGateway)
+			return
+		}
+		deleted += len(ids)
+	}
+
+	if deleted > 0 {
+		h.suggest.forget(collection)
+	}
+	log.Printf("[DELETE WHERE] Collection: %s | Filter: %v | Deleted %d chunks", collection, req.Where, deleted)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "deleted",
+		"collection": collection,
+		"deleted":    deleted,
+	})
+}
+
+// deleteIDs removes the given records from a collection.
+func (h *Handler) deleteIDs(colID string, ids []string) error {
+	reqBody, _ := json.Marshal(ChromaDeleteRequest{Ids: ids})
+	url := fmt.Sprintf("%s%s/%s/delete", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
+	resp, err := h.storeClient.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to POST to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("chroma delete returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// dimensionProbe is the text embedded to discover the default model's dimension.
+const dimensionProbe = "dimension probe"
+
+// dimensionCache remembers the default model's embedding dimension once known.
+// Failed detections aren't cached, so an Ollama that is down at startup is
+// simply asked again on the next use.
+type dimensionCache struct {
+	mu  sync.Mutex
+	dim int
+}
+
+// detectDimension returns the length of the vectors stored for the default
+// model. EMBED_DIM or EXPECTED_DIM answer it without a call; otherwise a
+// short probe is embedded once and the result cached.
+func (h *Handler) detectDimension() (int, error) {
+	if h.config.EmbedDim > 0 {
+		return h.config.EmbedDim, nil
+	}
+	if h.config.ExpectedDim > 0 {
+		return h.config.ExpectedDim, nil
+	}
+
+	h.dims.mu.Lock()
+	defer h.dims.mu.Unlock()
+	if h.dims.dim > 0 {
+		return h.dims.dim, nil
+	}
+	// The result is shared by every caller, so no one request's
+	// cancellation should abort it.
+	embedding, err := h.embedDocument(context.Background(), dimensionProbe, h.config.DefaultModel)
+	if err != nil {
+		return 0, fmt.Errorf("failed to detect embedding dimension of %s: %w", h.config.DefaultModel, err)
+	}
+	if len(embedding) == 0 {
+		return 0, fmt.Errorf("model %s returned an empty embedding", h.config.DefaultModel)
+	}
+	h.dims.dim = len(embedding)
+	log.Printf("[DIMENSION] %s produces %d-dimensional embeddings", h.config.DefaultModel, h.dims.dim)
+	return h.dims.dim, nil
+}
+
+// knownDimension returns the dimension if it is configured or already
+// detected, without calling Ollama (0 when unknown).
+func (h *Handler) knownDimension() int {
+	if h.config.EmbedDim > 0 {
+		return h.config.EmbedDim
+	}
+	if h.config.ExpectedDim > 0 {
+		return h.config.ExpectedDim
+	}
+	h.dims.mu.Lock()
+	defer h.dims.mu.Unlock()
+	return h.dims.dim
+}
+
+// InfoResponse describes the embedding setup clients need to interoperate,
+// e.g. to produce vectors for /api/import.
+type InfoResponse struct {
+	DefaultModel string   `json:"default_model"`
+	Models       []string `json:"models"`
+	Collection   string   `json:"collection"`
+	// EmbeddingDim is omitted when it can't be determined right now.
+	EmbeddingDim int    `json:"embedding_dim,omitempty"`
+	DimError     string `json:"embedding_dim_error,omitempty"`
+}
+
+// HandleInfo reports the configured models and collection along with the
+// default model's embedding dimension, detecting it if necessary.
+func (h *Handler) HandleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := InfoResponse{
+		DefaultModel: h.config.DefaultModel,
+		Models:       h.config.TargetModels,
+		Collection:   h.config.Collection,
+	}
+	if dim, err := h.detectDimension(); err != nil {
+		resp.DimError = err.Error()
+	} else {
+		resp.EmbeddingDim = dim
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package document
+
+// diskFree is not implemented on this platform; the free-space check is skipped.
+func diskFree(path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,47 @@
+package document
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Chroma's where filters only match metadata exactly, so each stored chunk
+// carries its full logical path ("reports/2024/q1.pdf") plus one key per
+// enclosing folder ("dir_1": "reports", "dir_2": "reports/2024"). A folder
+// prefix filter then becomes an exact match on the key for its depth.
+
+// normalizeDocPath cleans a client-supplied logical path, falling back to filename.
+func normalizeDocPath(p, filename string) string {
+	p = strings.Trim(path.Clean("/"+strings.ReplaceAll(p, "\\", "/")), "/")
+	if p == "" {
+		return filename
+	}
+	return p
+}
+
+// addPathMetadata records docPath and its folder prefixes in meta.
+func addPathMetadata(meta map[string]interface{}, docPath string) {
+	meta["path"] = docPath
+	parts := strings.Split(docPath, "/")
+	for depth := 1; depth < len(parts); depth++ {
+		meta[fmt.Sprintf("dir_%d", depth)] = strings.Join(parts[:depth], "/")
+	}
+}
+
+// pathPrefixFilter builds a where clause matching chunks stored under the
+// folder prefix, or the single document whose path equals it. Prefixes are
+// matched on whole path segments.
+func pathPrefixFilter(prefix string) map[string]interface{} {
+	prefix = strings.Trim(path.Clean("/"+prefix), "/")
+	if prefix == "" {
+		return nil
+	}
+	depth := strings.Count(prefix, "/") + 1
+	return map[string]interface{}{
+		"$or": []interface{}{
+			map[string]interface{}{fmt.Sprintf("dir_%d", depth): prefix},
+			map[string]interface{}{"path": prefix},
+		},
+	}
+}
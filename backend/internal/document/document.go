@@ -2,18 +2,23 @@ package document
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
+	"github.com/akhilmk/gowise/internal/config"
 	"github.com/google/uuid"
-	"github.com/ledongthuc/pdf"
 )
 
 type Config struct {
@@ -23,46 +28,541 @@ type Config struct {
 	DefaultModel  string
 	TargetModels  []string
 	Collection    string
+	UserAgent     string
+
+	// CollectionNamespace prefixes every collection name in Chroma (see chromaName).
+	CollectionNamespace string
+
+	// QueryRetries is how many times a failed Chroma query is retried, starting
+	// QueryRetryBackoff apart and doubling each time.
+	QueryRetries      int
+	QueryRetryBackoff time.Duration
+	// StaleCacheSize enables serving the last good response to a repeated search,
+	// marked "X-Cache: stale", when Chroma is failing (0 = disabled).
+	StaleCacheSize int
+
+	// EmbedTimeout bounds each Ollama embedding call; StoreTimeout each Chroma call (0 = none).
+	EmbedTimeout time.Duration
+	StoreTimeout time.Duration
+
+	// AutoCreateCollections lets read paths create a missing collection; when
+	// false they report ErrCollectionNotFound instead. Writes always create.
+	AutoCreateCollections bool
+
+	// ReadyRequiresModel makes /api/ready fail until the default model is loaded in Ollama.
+	ReadyRequiresModel bool
+	// DeepReadiness makes /api/ready embed and run a real query (see probeQuery).
+	DeepReadiness bool
+
+	// DocumentPrefix and QueryPrefix are prepended to embedding inputs for
+	// instruction-tuned models (e.g. "search_document: " / "search_query: ").
+	DocumentPrefix string
+	QueryPrefix    string
+	// QueryStopwords are removed from /api/search queries before embedding (nil = keep all).
+	QueryStopwords map[string]bool
+
+	// ChunkContextTemplate is a text/template rendering the text embedded for each
+	// chunk from ChunkContextData, e.g. "[{{.Filename}}] {{.Text}}" ("" = embed the
+	// chunk alone). The stored document is always the clean chunk.
+	ChunkContextTemplate string
+
+	// ExpectedDim is the embedding length every model must return (0 = not checked).
+	ExpectedDim int
+	// EmbedDim truncates longer embeddings to this many dimensions and
+	// re-normalizes them, for Matryoshka models (0 = keep native size).
+	// It applies to both stored chunks and queries.
+	EmbedDim int
+
+	// EmbedOptions are passed as Ollama "options" (e.g. num_ctx) on embedding requests.
+	EmbedOptions map[string]interface{}
+	// EmbedTruncate, when set, controls whether Ollama may truncate over-long
+	// inputs; false makes them fail loudly instead.
+	EmbedTruncate *bool
+
+	// RerankURL is an external /rerank endpoint (Cohere/Jina-style); empty disables reranking.
+	RerankURL        string
+	RerankModel      string
+	RerankCandidates int
+	RerankTimeout    time.Duration
+
+	// GenerationModel is the Ollama model that writes answers for /api/ask.
+	GenerationModel   string
+	GenerationTimeout time.Duration
+	// PromptTemplateFile is a text/template for /api/ask prompts ("" = built-in).
+	PromptTemplateFile string
+	// AskMinScore is the similarity the best retrieved chunk must reach before
+	// /api/ask calls the model; below it AskFallbackMessage is returned (0 = disabled).
+	AskMinScore        float32
+	AskFallbackMessage string
+	// ScoreFunction maps result distances to scores: linear, inverse or sigmoid.
+	// ScoreScale and ScoreMidpoint are its parameters (see score.go).
+	ScoreFunction string
+	ScoreScale    float64
+	ScoreMidpoint float64
+	// RAGRetrieveK is how many chunks /api/ask retrieves when the request has no k,
+	// before ContextTokenBudget decides how many of them reach the prompt.
+	RAGRetrieveK int
+	// ContextTokenBudget caps the approximate tokens of retrieved text in the prompt (0 = unlimited).
+	ContextTokenBudget int
+
+	// MMRCandidates is how many vector results MMR diversification chooses from.
+	MMRCandidates int
+
+	// BoostRules, BoostHalfLife and BoostRecencyWeight configure the default
+	// searchBoost; BoostCandidates is how many vector results it reorders.
+	BoostRules         []boostRule
+	BoostHalfLife      time.Duration
+	BoostRecencyWeight float64
+	BoostCandidates    int
+
+	// MaxChunksPerDoc caps how many chunks a single upload may produce (0 = unlimited).
+	MaxChunksPerDoc int
+	// TruncateOversized keeps the first MaxChunksPerDoc chunks instead of rejecting the upload.
+	TruncateOversized bool
+
+	// EmbedBatchSize is how many chunks are embedded per Ollama call during
+	// ingestion (1 = one call per chunk); EmbedBatchSizes overrides it per model.
+	EmbedBatchSize  int
+	EmbedBatchSizes map[string]int
+
+	// EmbedFailurePolicy decides what a chunk that fails to embed does to its
+	// upload: embedFailSkip, embedFailAbort or embedFailThreshold, which aborts
+	// once more than EmbedFailureThreshold percent of the chunks have failed.
+	EmbedFailurePolicy    string
+	EmbedFailureThreshold float64
+
+	// ChromaBatchSize is how many embedded chunks are buffered per Chroma add call.
+	ChromaBatchSize int
+	// ChromaMaxAddBytes splits an add request whose JSON body is larger than
+	// this into several (0 = no limit; Chroma rejecting a request as too
+	// large still splits it).
+	ChromaMaxAddBytes int64
+	// ChromaFlushInterval forces a flush of a partial batch after this long (0 = size-based only).
+	ChromaFlushInterval time.Duration
+
+	// MinChunkWords drops chunks shorter than this many words (0 = keep all).
+	MinChunkWords int
+	// MergeShortChunks folds short chunks into the previous chunk instead of dropping them.
+	MergeShortChunks bool
+
+	// ExtractTables detects tables in PDFs and stores each as extra Markdown
+	// chunks tagged type=table, alongside the flattened page text.
+	ExtractTables bool
+	// Dehyphenate rejoins words that PDF text splits across lines with a hyphen.
+	Dehyphenate bool
+	// NormalizeText cleans extracted text and queries with normalizeText.
+	NormalizeText bool
+
+	// NearDupThreshold skips chunks whose estimated similarity to a recent chunk
+	// of the same upload is at least this value (0 = disabled).
+	NearDupThreshold float64
+	// NearDupWindow is how many preceding kept chunks each chunk is compared against.
+	NearDupWindow int
+
+	// AllowedExtensions lists the lowercase file extensions accepted by /api/upload.
+	AllowedExtensions []string
+	// UploadFieldNames are the multipart fields /api/upload looks for the file in, in order.
+	UploadFieldNames []string
+
+	// PublicRoutes are read routes served without authentication (see readRoutes).
+	PublicRoutes []string
+
+	// TempDir is where large uploads are spooled ("" = system temp dir).
+	TempDir string
+	// InMemoryThreshold is the largest upload (in bytes) processed without a temp file.
+	InMemoryThreshold int64
+	// TempDirMinFree is the free space (in bytes) TempDir needs for readiness (0 = don't check).
+	TempDirMinFree int64
+
+	// UploadRetries is how often a failed embedding or storage call during an
+	// upload is retried, UploadRetryBackoff apart and doubling. UploadRetryBudget
+	// caps the retries of a whole upload; once spent, the next failure aborts it.
+	UploadRetries      int
+	UploadRetryBudget  int
+	UploadRetryBackoff time.Duration
+
+	// IngestMaxBytes caps /api/ingest request bodies.
+	IngestMaxBytes int64
+	// URLIngestMaxBytes and URLIngestTimeout bound documents fetched by
+	// /api/ingest/url; URLIngestAllowPrivate lets it fetch from internal addresses.
+	URLIngestMaxBytes     int64
+	URLIngestTimeout      time.Duration
+	URLIngestAllowPrivate bool
+
+	// FilenameCollision decides what happens when an upload's filename is
+	// already used in its collection: keep, suffix or reject.
+	FilenameCollision string
+	// SkipDuplicateUploads answers an upload whose exact file is already in its
+	// collection with "already_ingested" instead of ingesting it again.
+	SkipDuplicateUploads bool
+
+	// AdminSearchAllCollections makes an admin's search without a collection
+	// parameter cover every collection instead of the default one.
+	AdminSearchAllCollections bool
+
+	// ResetRecreate makes /api/reset create the emptied collection again straight away.
+	ResetRecreate bool
+
+	// MaxConcurrentUploads bounds how many uploads are processed at once (0 = unlimited).
+	MaxConcurrentUploads int
+	// OllamaMaxConcurrency bounds in-flight embedding calls across all requests (0 = unlimited).
+	OllamaMaxConcurrency int
+	// UploadQueueTimeout is how long an upload waits for a free slot before getting a 503.
+	UploadQueueTimeout time.Duration
+
+	// Connection pool limits of the transport shared by all outbound clients
+	// (see newTransport), with http.Transport's meaning of 0: unlimited,
+	// except that 0 idle connections per host falls back to Go's default of 2.
+	HTTPMaxIdleConns        int
+	HTTPMaxIdleConnsPerHost int
+	HTTPMaxConnsPerHost     int
+	HTTPIdleConnTimeout     time.Duration
+
+	// Per-user (JWT username or API key) and per-IP request quotas over each
+	// QuotaWindow (0 = unlimited). Searches cover search, batch search (one
+	// per query), ask, embed and compare (one per text); uploads cover
+	// upload, ingest, URL ingest and import.
+	QuotaWindow     time.Duration
+	UserUploadQuota int
+	UserSearchQuota int
+	IPUploadQuota   int
+	IPSearchQuota   int
 }
 
+const (
+	defaultTopK = 5
+	maxTopK     = 100
+
+	defaultMMRLambda = 0.5
+)
+
+// Handler serves the document API. A single Handler is meant to be shared by
+// all requests: it is safe for concurrent use once NewHandler returns. Its
+// fields are set only by NewHandler; the state that changes afterwards lives
+// behind types that guard themselves (staleCache, quotas and suggest use a
+// mutex, uploadSlots and embedSlots are channels), and per-request state such
+// as retry budgets is created for each request. New mutable state must follow
+// the same rule.
 type Handler struct {
 	config Config
+	// client has no overall timeout and serves long-running Ollama calls (pulls,
+	// generation, which bound themselves); embedClient and storeClient carry
+	// EMBED_TIMEOUT and STORE_TIMEOUT for embedding and Chroma calls respectively.
+	client      *http.Client
+	embedClient *http.Client
+	storeClient *http.Client
+	// fetchClient downloads documents for URL ingest, refusing internal addresses.
+	fetchClient *http.Client
+
+	promptTemplate *template.Template
+	// chunkContext renders ChunkContextTemplate; nil when contextual chunking is off.
+	chunkContext *template.Template
+	// score maps result distances to scores per SCORE_FUNCTION.
+	score scoreFunc
+
+	// staleCache holds recent search responses for serving while Chroma is down; nil when disabled.
+	staleCache *responseCache
+
+	// uploadSlots is a counting semaphore for in-flight uploads; nil when unlimited.
+	uploadSlots chan struct{}
+	// embedSlots bounds in-flight embedding calls to Ollama across all requests; nil when unlimited.
+	embedSlots chan struct{}
+
+	// quotas counts requests against the per-user and per-IP quotas; nil when none are set.
+	quotas *quotaTracker
+
+	// suggest holds the per-collection term counts behind /api/suggest.
+	suggest *suggestIndex
+	// dims caches the default model's embedding dimension; see detectDimension.
+	dims *dimensionCache
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// LoadConfig builds the document service configuration from the JSON file
+// at path (may be empty) overlaid with environment variables. Values that fail
+// to parse are reported in the returned error; call Validate for semantic checks.
+func LoadConfig(path string) (Config, error) {
+	src, err := config.Load(path)
+	if err != nil {
+		return Config{}, err
 	}
-	return defaultValue
-}
 
-func NewHandler() *Handler {
-	envModels := getEnv("EMBEDDING_MODELS", "")
 	var targetModels []string
 
 	// Parse comma-separated models
-	parts := strings.Split(envModels, ",")
+	parts := strings.Split(src.String("EMBEDDING_MODELS", ""), ",")
 	for _, p := range parts {
 		if trimmed := strings.TrimSpace(p); trimmed != "" {
 			targetModels = append(targetModels, trimmed)
 		}
 	}
 
-	// Validate configuration
-	if len(targetModels) == 0 {
-		log.Printf("[CRITICAL ERROR] EMBEDDING_MODELS environment variable is required but missing. Uploads and search will fail!")
-		targetModels = []string{"UNCONFIGURED_MODEL"}
+	defaultModel := ""
+	if len(targetModels) > 0 {
+		defaultModel = targetModels[0] // Use first model as default
 	}
 
-	h := &Handler{
-		config: Config{
-			OllamaURL:     getEnv("OLLAMA_URL", "http://localhost:11434"),
-			ChromaURL:     getEnv("CHROMA_URL", "http://localhost:8000"),
-			ChromaAPIBase: "/api/v2/tenants/default_tenant/databases/default_database/collections",
-			DefaultModel:  targetModels[0], // Use first model as default
-			TargetModels:  targetModels,
-			Collection:    getEnv("COLLECTION_NAME", "documents"),
-		},
+	cfg := Config{
+		OllamaURL:     src.String("OLLAMA_URL", "http://localhost:11434"),
+		ChromaURL:     src.String("CHROMA_URL", "http://localhost:8000"),
+		ChromaAPIBase: "/api/v2/tenants/default_tenant/databases/default_database/collections",
+		DefaultModel:  defaultModel,
+		TargetModels:  targetModels,
+		Collection:    src.String("COLLECTION_NAME", "documents"),
+		UserAgent:     src.String("USER_AGENT", "gowise/1.0.0"),
+
+		CollectionNamespace: src.String("COLLECTION_NAMESPACE", ""),
+
+		QueryRetries:      src.Int("QUERY_RETRIES", 2),
+		QueryRetryBackoff: src.Duration("QUERY_RETRY_BACKOFF", 200*time.Millisecond),
+		StaleCacheSize:    src.Int("STALE_CACHE_SIZE", 0),
+
+		EmbedTimeout: src.Duration("EMBED_TIMEOUT", 60*time.Second),
+		StoreTimeout: src.Duration("STORE_TIMEOUT", 30*time.Second),
+
+		AutoCreateCollections: src.Bool("AUTO_CREATE_COLLECTIONS", true),
+
+		ReadyRequiresModel: src.Bool("READY_REQUIRES_MODEL", false),
+		DeepReadiness:      src.Bool("DEEP_READINESS", false),
+
+		DocumentPrefix:       src.String("EMBED_DOCUMENT_PREFIX", ""),
+		QueryPrefix:          src.String("EMBED_QUERY_PREFIX", ""),
+		QueryStopwords:       parseStopwords(src.String("QUERY_STOPWORDS", "")),
+		ChunkContextTemplate: src.String("CHUNK_CONTEXT_TEMPLATE", ""),
+
+		ExpectedDim: src.Int("EXPECTED_DIM", 0),
+		EmbedDim:    src.Int("EMBED_DIM", 0),
+
+		RerankURL:        src.String("RERANK_URL", ""),
+		RerankModel:      src.String("RERANK_MODEL", ""),
+		RerankCandidates: src.Int("RERANK_CANDIDATES", 20),
+		RerankTimeout:    src.Duration("RERANK_TIMEOUT", 15*time.Second),
+
+		GenerationModel:    src.String("GENERATION_MODEL", ""),
+		GenerationTimeout:  src.Duration("GENERATION_TIMEOUT", 2*time.Minute),
+		ContextTokenBudget: src.Int("CONTEXT_TOKEN_BUDGET", 3000),
+		RAGRetrieveK:       src.Int("RAG_RETRIEVE_K", defaultTopK),
+		AskMinScore:        float32(src.Float("ASK_MIN_SCORE", 0)),
+		AskFallbackMessage: src.String("ASK_FALLBACK_MESSAGE", "I don't have enough information in the indexed documents to answer that."),
+		ScoreFunction:      src.String("SCORE_FUNCTION", scoreLinear),
+		ScoreScale:         src.Float("SCORE_SCALE", 1),
+		ScoreMidpoint:      src.Float("SCORE_MIDPOINT", 0.5),
+		PromptTemplateFile: src.String("PROMPT_TEMPLATE_FILE", ""),
+
+		MMRCandidates: src.Int("MMR_CANDIDATES", 20),
+
+		BoostHalfLife:      src.Duration("BOOST_RECENCY_HALF_LIFE", 0),
+		BoostRecencyWeight: src.Float("BOOST_RECENCY_WEIGHT", 0.3),
+		BoostCandidates:    src.Int("BOOST_CANDIDATES", 20),
+
+		MaxChunksPerDoc:   src.Int("MAX_CHUNKS_PER_DOC", 0),
+		TruncateOversized: src.String("MAX_CHUNKS_MODE", "reject") == "truncate",
+
+		EmbedBatchSize:        src.Int("EMBED_BATCH_SIZE", 1),
+		EmbedFailurePolicy:    src.String("EMBED_FAILURE_POLICY", embedFailSkip),
+		EmbedFailureThreshold: src.Float("EMBED_FAILURE_THRESHOLD", 10),
+		ChromaBatchSize:       src.Int("CHROMA_BATCH_SIZE", 16),
+		ChromaMaxAddBytes:     int64(src.Int("CHROMA_MAX_ADD_BYTES", 0)),
+		ChromaFlushInterval:   src.Duration("CHROMA_FLUSH_INTERVAL", 30*time.Second),
+
+		MinChunkWords:    src.Int("MIN_CHUNK_WORDS", 0),
+		MergeShortChunks: src.String("MIN_CHUNK_MODE", "drop") == "merge",
+		ExtractTables:    src.Bool("EXTRACT_TABLES", false),
+		Dehyphenate:      src.Bool("PDF_DEHYPHENATE", false),
+		NormalizeText:    src.Bool("NORMALIZE_TEXT", false),
+
+		NearDupThreshold: src.Float("NEAR_DUP_THRESHOLD", 0),
+		NearDupWindow:    src.Int("NEAR_DUP_WINDOW", 50),
+
+		AllowedExtensions: parseExtensions(src.String("ALLOWED_EXTENSIONS", ".pdf,.txt,.md")),
+		UploadFieldNames:  strings.FieldsFunc(src.String("UPLOAD_FIELD_NAMES", "file,files,document"), func(r rune) bool { return r == ',' || r == ' ' }),
+		PublicRoutes:      strings.FieldsFunc(src.String("PUBLIC_ROUTES", ""), func(r rune) bool { return r == ',' || r == ' ' }),
+
+		TempDir:           src.String("UPLOAD_TEMP_DIR", ""),
+		InMemoryThreshold: int64(src.Int("UPLOAD_MEMORY_THRESHOLD", 1<<20)),
+		TempDirMinFree:    int64(src.Int("UPLOAD_TEMP_MIN_FREE", 100<<20)),
+
+		UploadRetries:      src.Int("UPLOAD_RETRIES", 2),
+		UploadRetryBudget:  src.Int("UPLOAD_RETRY_BUDGET", 20),
+		UploadRetryBackoff: src.Duration("UPLOAD_RETRY_BACKOFF", 500*time.Millisecond),
+
+		IngestMaxBytes:        int64(src.Int("INGEST_MAX_BYTES", 10<<20)),
+		URLIngestMaxBytes:     int64(src.Int("URL_INGEST_MAX_BYTES", 50<<20)),
+		URLIngestTimeout:      src.Duration("URL_INGEST_TIMEOUT", 60*time.Second),
+		URLIngestAllowPrivate: src.Bool("URL_INGEST_ALLOW_PRIVATE", false),
+		FilenameCollision:     src.String("FILENAME_COLLISION", collisionKeep),
+		SkipDuplicateUploads:  src.Bool("SKIP_DUPLICATE_UPLOADS", true),
+		ResetRecreate:         src.Bool("RESET_RECREATE", false),
+
+		AdminSearchAllCollections: src.Bool("ADMIN_SEARCH_ALL_COLLECTIONS", false),
+
+		MaxConcurrentUploads: src.Int("MAX_CONCURRENT_UPLOADS", 0),
+		OllamaMaxConcurrency: src.Int("OLLAMA_MAX_CONCURRENCY", 0),
+		UploadQueueTimeout:   src.Duration("UPLOAD_QUEUE_TIMEOUT", 0),
+
+		HTTPMaxIdleConns:        src.Int("HTTP_MAX_IDLE_CONNS", 100),
+		HTTPMaxIdleConnsPerHost: src.Int("HTTP_MAX_IDLE_CONNS_PER_HOST", 32),
+		HTTPMaxConnsPerHost:     src.Int("HTTP_MAX_CONNS_PER_HOST", 0),
+		HTTPIdleConnTimeout:     src.Duration("HTTP_IDLE_CONN_TIMEOUT", 90*time.Second),
+
+		QuotaWindow:     src.Duration("QUOTA_WINDOW", time.Hour),
+		UserUploadQuota: src.Int("QUOTA_USER_UPLOADS", 0),
+		UserSearchQuota: src.Int("QUOTA_USER_SEARCHES", 0),
+		IPUploadQuota:   src.Int("QUOTA_IP_UPLOADS", 0),
+		IPSearchQuota:   src.Int("QUOTA_IP_SEARCHES", 0),
+	}
+
+	if err := cfg.parseEmbedOptions(src.String("EMBED_OPTIONS", "")); err != nil {
+		src.Check(false, "EMBED_OPTIONS", "%v", err)
+	}
+	if cfg.EmbedBatchSizes, err = parseBatchSizes(src.String("EMBED_BATCH_SIZES", "")); err != nil {
+		src.Check(false, "EMBED_BATCH_SIZES", "%v", err)
+	}
+	if cfg.BoostRules, err = parseBoostRules(src.String("BOOST_METADATA", "")); err != nil {
+		src.Check(false, "BOOST_METADATA", "%v", err)
+	}
+
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		src.Check(false, key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+	}
+	oneOf("MAX_CHUNKS_MODE", src.String("MAX_CHUNKS_MODE", "reject"), "reject", "truncate")
+	oneOf("MIN_CHUNK_MODE", src.String("MIN_CHUNK_MODE", "drop"), "drop", "merge")
+	oneOf("FILENAME_COLLISION", cfg.FilenameCollision, collisionKeep, collisionSuffix, collisionReject)
+	oneOf("SCORE_FUNCTION", cfg.ScoreFunction, scoreLinear, scoreInverse, scoreSigmoid)
+	oneOf("EMBED_FAILURE_POLICY", cfg.EmbedFailurePolicy, embedFailSkip, embedFailAbort, embedFailThreshold)
+
+	return cfg, src.Err()
+}
+
+// Validate checks that the configuration is usable: URLs parse, required
+// settings are present and numeric settings are in range.
+func (c Config) Validate() error {
+	var v config.Checker
+	v.Check(len(c.TargetModels) > 0, "EMBEDDING_MODELS", "at least one embedding model is required")
+	v.Check(c.UserAgent != "", "USER_AGENT", "must not be empty")
+	v.CheckURL("OLLAMA_URL", c.OllamaURL, false)
+	v.CheckURL("CHROMA_URL", c.ChromaURL, false)
+	v.CheckURL("RERANK_URL", c.RerankURL, true)
+	v.Check(validCollectionName(c.Collection), "COLLECTION_NAME", "%q is not a valid ChromaDB collection name", c.Collection)
+	v.Check(c.CollectionNamespace == "" || validCollectionName(c.chromaName(c.Collection)), "COLLECTION_NAMESPACE",
+		"%q is not a valid ChromaDB collection name", c.chromaName(c.Collection))
+	v.Check(len(c.AllowedExtensions) > 0, "ALLOWED_EXTENSIONS", "must list at least one extension")
+	for _, ext := range c.AllowedExtensions {
+		v.Check(slices.Contains(supportedExtensions, ext), "ALLOWED_EXTENSIONS", "%q has no text extractor; supported: %s", ext, strings.Join(supportedExtensions, ", "))
+	}
+	v.Check(len(c.UploadFieldNames) > 0, "UPLOAD_FIELD_NAMES", "must list at least one form field name")
+	for _, route := range c.PublicRoutes {
+		v.Check(slices.Contains(readRoutes, route), "PUBLIC_ROUTES", "%q is not a read-only route; allowed: %s", route, strings.Join(readRoutes, ", "))
+	}
+	for _, f := range []struct {
+		key   string
+		value int
+	}{
+		{"CHROMA_BATCH_SIZE", c.ChromaBatchSize},
+		{"EMBED_BATCH_SIZE", c.EmbedBatchSize},
+		{"RERANK_CANDIDATES", c.RerankCandidates},
+		{"MMR_CANDIDATES", c.MMRCandidates},
+		{"BOOST_CANDIDATES", c.BoostCandidates},
+		{"QUOTA_WINDOW", int(c.QuotaWindow)},
+		{"INGEST_MAX_BYTES", int(c.IngestMaxBytes)},
+		{"URL_INGEST_MAX_BYTES", int(c.URLIngestMaxBytes)},
+	} {
+		v.Check(f.value > 0, f.key, "must be positive, got %d", f.value)
+	}
+	for _, f := range []struct {
+		key   string
+		value int64
+	}{
+		{"QUERY_RETRIES", int64(c.QueryRetries)},
+		{"STALE_CACHE_SIZE", int64(c.StaleCacheSize)},
+		{"EXPECTED_DIM", int64(c.ExpectedDim)},
+		{"EMBED_DIM", int64(c.EmbedDim)},
+		{"CONTEXT_TOKEN_BUDGET", int64(c.ContextTokenBudget)},
+		{"MAX_CHUNKS_PER_DOC", int64(c.MaxChunksPerDoc)},
+		{"MIN_CHUNK_WORDS", int64(c.MinChunkWords)},
+		{"NEAR_DUP_WINDOW", int64(c.NearDupWindow)},
+		{"UPLOAD_MEMORY_THRESHOLD", c.InMemoryThreshold},
+		{"CHROMA_MAX_ADD_BYTES", c.ChromaMaxAddBytes},
+		{"UPLOAD_TEMP_MIN_FREE", c.TempDirMinFree},
+		{"UPLOAD_RETRIES", int64(c.UploadRetries)},
+		{"UPLOAD_RETRY_BUDGET", int64(c.UploadRetryBudget)},
+		{"UPLOAD_RETRY_BACKOFF", int64(c.UploadRetryBackoff)},
+		{"MAX_CONCURRENT_UPLOADS", int64(c.MaxConcurrentUploads)},
+		{"OLLAMA_MAX_CONCURRENCY", int64(c.OllamaMaxConcurrency)},
+		{"QUERY_RETRY_BACKOFF", int64(c.QueryRetryBackoff)},
+		{"EMBED_TIMEOUT", int64(c.EmbedTimeout)},
+		{"STORE_TIMEOUT", int64(c.StoreTimeout)},
+		{"RERANK_TIMEOUT", int64(c.RerankTimeout)},
+		{"GENERATION_TIMEOUT", int64(c.GenerationTimeout)},
+		{"CHROMA_FLUSH_INTERVAL", int64(c.ChromaFlushInterval)},
+		{"UPLOAD_QUEUE_TIMEOUT", int64(c.UploadQueueTimeout)},
+		{"URL_INGEST_TIMEOUT", int64(c.URLIngestTimeout)},
+		{"BOOST_RECENCY_HALF_LIFE", int64(c.BoostHalfLife)},
+		{"HTTP_MAX_IDLE_CONNS", int64(c.HTTPMaxIdleConns)},
+		{"HTTP_MAX_IDLE_CONNS_PER_HOST", int64(c.HTTPMaxIdleConnsPerHost)},
+		{"HTTP_MAX_CONNS_PER_HOST", int64(c.HTTPMaxConnsPerHost)},
+		{"HTTP_IDLE_CONN_TIMEOUT", int64(c.HTTPIdleConnTimeout)},
+		{"QUOTA_USER_UPLOADS", int64(c.UserUploadQuota)},
+		{"QUOTA_USER_SEARCHES", int64(c.UserSearchQuota)},
+		{"QUOTA_IP_UPLOADS", int64(c.IPUploadQuota)},
+		{"QUOTA_IP_SEARCHES", int64(c.IPSearchQuota)},
+	} {
+		v.Check(f.value >= 0, f.key, "must not be negative")
+	}
+	v.Check(c.ExpectedDim == 0 || c.EmbedDim <= c.ExpectedDim, "EMBED_DIM", "must not exceed EXPECTED_DIM (%d), got %d", c.ExpectedDim, c.EmbedDim)
+	v.Check(c.EmbedFailureThreshold >= 0 && c.EmbedFailureThreshold <= 100, "EMBED_FAILURE_THRESHOLD", "must be between 0 and 100, got %g", c.EmbedFailureThreshold)
+	v.Check(c.RAGRetrieveK >= 1 && c.RAGRetrieveK <= maxTopK, "RAG_RETRIEVE_K", "must be between 1 and %d, got %d", maxTopK, c.RAGRetrieveK)
+	v.Check(c.AskMinScore >= 0 && c.AskMinScore <= 1, "ASK_MIN_SCORE", "must be between 0 and 1")
+	v.Check(c.BoostRecencyWeight >= 0 && c.BoostRecencyWeight <= 1, "BOOST_RECENCY_WEIGHT", "must be between 0 and 1, got %g", c.BoostRecencyWeight)
+	v.Check(c.ScoreScale > 0, "SCORE_SCALE", "must be positive, got %g", c.ScoreScale)
+	if _, err := parseChunkContextTemplate(c.ChunkContextTemplate); err != nil {
+		v.Check(false, "CHUNK_CONTEXT_TEMPLATE", "%v", err)
+	}
+	v.Check(c.NearDupThreshold >= 0 && c.NearDupThreshold <= 1, "NEAR_DUP_THRESHOLD", "must be between 0 and 1")
+
+	return v.Err()
+}
+
+// NewHandler creates a document handler from a validated configuration.
+func NewHandler(cfg Config) *Handler {
+	h := &Handler{config: cfg, suggest: newSuggestIndex(), dims: &dimensionCache{}}
+
+	transport := newTransport(h.config)
+	h.client = newHTTPClient(h.config.UserAgent, 0, transport)
+	h.embedClient = newHTTPClient(h.config.UserAgent, h.config.EmbedTimeout, transport)
+	h.storeClient = newHTTPClient(h.config.UserAgent, h.config.StoreTimeout, transport)
+	h.fetchClient = newFetchClient(h.config.UserAgent, h.config.URLIngestTimeout, h.config.URLIngestAllowPrivate)
+
+	tmpl, err := loadPromptTemplate(h.config.PromptTemplateFile)
+	if err != nil {
+		log.Fatalf("[CONFIG ERROR] PROMPT_TEMPLATE_FILE: %v", err)
+	}
+	h.promptTemplate = tmpl
+	h.chunkContext, _ = parseChunkContextTemplate(h.config.ChunkContextTemplate)
+	h.score, _ = newScoreFunc(h.config.ScoreFunction, h.config.ScoreScale, h.config.ScoreMidpoint)
+
+	// Surface a broken temp dir now rather than on the first large upload.
+	if err := h.checkTempDir(); err != nil {
+		log.Printf("[CONFIG ERROR] Uploads will fail: %v", err)
+	}
+
+	if h.config.StaleCacheSize > 0 {
+		h.staleCache = newResponseCache(h.config.StaleCacheSize)
+	}
+
+	if h.config.MaxConcurrentUploads > 0 {
+		h.uploadSlots = make(chan struct{}, h.config.MaxConcurrentUploads)
+	}
+	if h.config.OllamaMaxConcurrency > 0 {
+		h.embedSlots = make(chan struct{}, h.config.OllamaMaxConcurrency)
+	}
+
+	if h.config.UserUploadQuota > 0 || h.config.UserSearchQuota > 0 || h.config.IPUploadQuota > 0 || h.config.IPSearchQuota > 0 {
+		h.quotas = newQuotaTracker(h.config.QuotaWindow)
 	}
 
 	// Initialize embedding model on startup (async)
@@ -71,20 +571,46 @@ func NewHandler() *Handler {
 	return h
 }
 
-func (h *Handler) RegisterRoutes(mux *http.ServeMux, mw func(http.HandlerFunc) http.HandlerFunc) {
-	mux.HandleFunc("/api/reset", mw(h.HandleReset))
-	mux.HandleFunc("/api/upload", mw(h.HandleUpload))
-	mux.HandleFunc("/api/search", mw(h.HandleSearch))
-	mux.HandleFunc("/api/stats", mw(h.HandleStats))
-	mux.HandleFunc("/api/files/", mw(h.HandleDeleteFile))
-	mux.HandleFunc("/api/models", mw(h.HandleModels))
+// RegisterRoutes wraps read-only routes with mw, unless PUBLIC_ROUTES makes
+// them public, and routes that modify the collection with writeMW.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux, mw, writeMW func(http.HandlerFunc) http.HandlerFunc) {
+	read := func(path string, next http.HandlerFunc) {
+		if h.config.isPublic(path) {
+			log.Printf("[AUTH] %s is public (PUBLIC_ROUTES)", path)
+			mux.HandleFunc(path, next)
+			return
+		}
+		mux.HandleFunc(path, mw(next))
+	}
+	mux.HandleFunc("/api/reset", writeMW(h.HandleReset))
+	mux.HandleFunc("/api/collections/rename", writeMW(h.HandleRenameCollection))
+	mux.HandleFunc("/api/compact", writeMW(h.HandleCompact))
+	mux.HandleFunc("/api/selftest", writeMW(h.HandleSelfTest))
+	mux.HandleFunc("/api/upload", writeMW(h.withQuota(quotaUpload, h.HandleUpload)))
+	mux.HandleFunc("/api/ingest", writeMW(h.withQuota(quotaUpload, h.HandleIngest)))
+	mux.HandleFunc("/api/ingest/url", writeMW(h.withQuota(quotaUpload, h.HandleIngestURL)))
+	mux.HandleFunc("/api/import", writeMW(h.withQuota(quotaUpload, h.HandleImport)))
+	read("/api/search", h.withQuota(quotaSearch, h.HandleSearch))
+	read("/api/suggest", h.HandleSuggest)
+	read("/api/search/batch", h.HandleBatchSearch) // charges one search per query
+	read("/api/ask", h.withQuota(quotaSearch, h.HandleAsk))
+	read("/api/stats", h.HandleStats)
+	read("/api/corpus/stats", h.HandleCorpusStats)
+	read("/api/export", h.HandleExport)
+	read("/api/extract/preview", h.HandleExtractPreview)
+	mux.HandleFunc("/api/files/", writeMW(h.HandleDeleteFile))
+	mux.HandleFunc("/api/delete", writeMW(h.HandleDeleteWhere))
+	read("/api/models", h.HandleModels)
+	read("/api/info", h.HandleInfo)
+	read("/api/embed", h.withQuota(quotaSearch, h.HandleEmbed))
+	read("/api/compare", h.HandleCompare) // charges one search per text
 }
 
 func (h *Handler) initializeEmbeddingModel() {
 	log.Printf("[STARTUP] Initializing %d embedding models", len(h.config.TargetModels))
 
 	// Check if Ollama is reachable once
-	resp, err := http.Get(h.config.OllamaURL + "/api/tags")
+	resp, err := h.client.Get(h.config.OllamaURL + "/api/tags")
 	if err != nil {
 		log.Printf("[STARTUP WARNING] Failed to connect to Ollama: %v", err)
 		log.Printf("[STARTUP WARNING] Skipping model initialization - please ensure Ollama is running")
@@ -130,7 +656,7 @@ func (h *Handler) initializeEmbeddingModel() {
 		pullReq := map[string]string{"name": targetModel}
 		pullBody, _ := json.Marshal(pullReq)
 
-		pullResp, err := http.Post(h.config.OllamaURL+"/api/pull", "application/json", bytes.NewBuffer(pullBody))
+		pullResp, err := h.client.Post(h.config.OllamaURL+"/api/pull", "application/json", bytes.NewBuffer(pullBody))
 		if err != nil {
 			log.Printf("[STARTUP WARNING] Failed to pull model %s: %v", targetModel, err)
 			log.Printf("[STARTUP WARNING] You may need to manually run: ollama pull %s", targetModel)
@@ -171,18 +697,35 @@ func (h *Handler) initializeEmbeddingModel() {
 		log.Printf("[STARTUP] Successfully initialized embedding model: %s", targetModel)
 	}
 	log.Printf("[STARTUP] All model initializations complete")
+
+	// Detection is retried on first use if it fails here, so boot never waits on it.
+	if _, err := h.detectDimension(); err != nil {
+		log.Printf("[STARTUP WARNING] %v", err)
+	}
 }
 
 // Request/Response Structs
 type EmbeddingRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model   string                 `json:"model"`
+	Prompt  string                 `json:"prompt"`
+	Options map[string]interface{} `json:"options,omitempty"`
 }
 
 type EmbeddingResponse struct {
 	Embedding []float32 `json:"embedding"`
 }
 
+type BatchEmbeddingRequest struct {
+	Model    string                 `json:"model"`
+	Input    []string               `json:"input"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+	Truncate *bool                  `json:"truncate,omitempty"`
+}
+
+type BatchEmbeddingResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
 type ChromaAddRequest struct {
 	Documents  []string      `json:"documents"`
 	Metadatas  []interface{} `json:"metadatas"`
@@ -191,15 +734,45 @@ type ChromaAddRequest struct {
 }
 
 type ChromaQueryRequest struct {
-	QueryEmbeddings [][]float32 `json:"query_embeddings"`
-	NResults        int         `json:"n_results"`
+	QueryEmbeddings [][]float32            `json:"query_embeddings"`
+	NResults        int                    `json:"n_results"`
+	Include         []string               `json:"include,omitempty"`
+	Where           map[string]interface{} `json:"where,omitempty"`
 }
 
 type ChromaQueryResponse struct {
-	Ids       [][]string      `json:"ids"`
-	Documents [][]string      `json:"documents"`
-	Metadatas [][]interface{} `json:"metadatas"`
-	Distances [][]float32     `json:"distances"`
+	Ids        [][]string      `json:"ids"`
+	Documents  [][]string      `json:"documents"`
+	Metadatas  [][]interface{} `json:"metadatas"`
+	Distances  [][]float32     `json:"distances"`
+	Embeddings [][][]float32   `json:"embeddings,omitempty"`
+}
+
+// SearchResult is a single flattened hit from a Chroma query.
+type SearchResult struct {
+	ID          string                 `json:"id"`
+	Document    string                 `json:"document"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	Distance    float32                `json:"distance"`
+	Score       float32                `json:"score"`
+	RerankScore *float64               `json:"rerank_score,omitempty"`
+	// Boost is the metadata boost factor and BoostedScore the relevance it
+	// scaled, which results are ordered by, when boosting is on.
+	Boost        *float32 `json:"boost,omitempty"`
+	BoostedScore *float64 `json:"boosted_score,omitempty"`
+	// Collection is the collection the hit came from, for provenance in multi-collection UIs.
+	Collection string `json:"collection"`
+
+	// Embedding is only serialized when the client asks for it with includeEmbeddings=true.
+	Embedding []float32 `json:"embedding,omitempty"`
+}
+
+// SearchResponse is the body returned by HandleSearch.
+type SearchResponse struct {
+	Query       string         `json:"query"`
+	Results     []SearchResult `json:"results"`
+	Reranked    bool           `json:"reranked"`
+	Diversified bool           `json:"diversified"`
 }
 
 type ChromaGetResponse struct {
@@ -213,7 +786,8 @@ type ChromaCountResponse struct {
 }
 
 type ChromaDeleteRequest struct {
-	Where map[string]interface{} `json:"where"`
+	Ids   []string               `json:"ids,omitempty"`
+	Where map[string]interface{} `json:"where,omitempty"`
 }
 
 type ChromaDeleteResponse struct {
@@ -227,6 +801,41 @@ type StatsResponse struct {
 	FileChunkCounts map[string]int `json:"file_chunk_counts"`
 }
 
+// IngestResult summarizes the outcome of processing a single upload.
+type IngestResult struct {
+	TotalChunks   int
+	StoredChunks  int
+	DroppedChunks int
+	// NearDuplicateChunks counts chunks skipped as near-duplicates of earlier ones.
+	NearDuplicateChunks int
+	// TableChunks counts the Markdown table chunks added by EXTRACT_TABLES.
+	TableChunks int
+	// FailedChunks counts chunks left out because they could not be embedded.
+	FailedChunks int
+	// Failures details chunks that failed to embed or store, up to maxReportedFailures.
+	Failures []ChunkFailure
+	// FailuresTruncated is set when more failures occurred than Failures holds.
+	FailuresTruncated bool
+	Truncated         bool
+	Warnings          []string
+}
+
+// uploadError carries the HTTP status an upload should be rejected with.
+// err, if set, is a sentinel callers can match with errors.Is.
+type uploadError struct {
+	status int
+	msg    string
+	err    error
+}
+
+func (e *uploadError) Error() string {
+	return e.msg
+}
+
+func (e *uploadError) Unwrap() error {
+	return e.err
+}
+
 type OllamaModel struct {
 	Name       string `json:"name"`
 	ModifiedAt string `json:"modified_at"`
@@ -247,7 +856,7 @@ func (h *Handler) HandleModels(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Fetching available Ollama models")
 
-	resp, err := http.Get(h.config.OllamaURL + "/api/tags")
+	resp, err := h.client.Get(h.config.OllamaURL + "/api/tags")
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to fetch models: %v", err), http.StatusInternalServerError)
 		return
@@ -277,31 +886,91 @@ func (h *Handler) HandleReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Resetting collection: %s", h.config.Collection)
+	collection, err := h.requestCollection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Resetting collection: %s", collection)
+
+	if err := h.deleteCollection(collection); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.suggest.forget(collection)
+
+	resp := map[string]string{"status": "reset successful", "collection": collection}
+	recreate := h.config.ResetRecreate
+	if v := r.URL.Query().Get("recreate"); v != "" {
+		recreate = v == "true"
+	}
+	if recreate {
+		// Recreating right away means the collection exists, empty, from the
+		// moment reset returns rather than whenever the next write creates it.
+		id, err := h.getOrCreateCollection(collection)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("collection deleted but not recreated: %v", err), http.StatusBadGateway)
+			return
+		}
+		resp["collectionId"] = id
+		log.Printf("Recreated collection %s as %s", collection, id)
+	}
 
-	url := fmt.Sprintf("%s%s/%s", h.config.ChromaURL, h.config.ChromaAPIBase, h.config.Collection)
+	log.Printf("Collection reset successful")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// deleteCollection drops the named collection; a missing one is not an error.
+func (h *Handler) deleteCollection(name string) error {
+	url := fmt.Sprintf("%s%s/%s", h.config.ChromaURL, h.config.ChromaAPIBase, h.config.chromaName(name))
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to create request: %v", err), http.StatusInternalServerError)
-		return
+		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := h.storeClient.Do(req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to delete collection: %v", err), http.StatusInternalServerError)
-		return
+		return fmt.Errorf("failed to delete collection: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
 		body, _ := io.ReadAll(resp.Body)
-		http.Error(w, fmt.Sprintf("chroma reset error: %s", string(body)), http.StatusInternalServerError)
-		return
+		return fmt.Errorf("chroma reset error: %s", string(body))
+	}
+	return nil
+}
+
+// acquireUploadSlot waits up to UploadQueueTimeout for a free upload slot.
+// The returned release func must be called once the upload is done.
+func (h *Handler) acquireUploadSlot(r *http.Request) (func(), bool) {
+	if h.uploadSlots == nil {
+		return func() {}, true
 	}
+	release := func() { <-h.uploadSlots }
 
-	log.Printf("Collection reset successful")
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "reset successful", "collection": h.config.Collection})
+	select {
+	case h.uploadSlots <- struct{}{}:
+		return release, true
+	default:
+	}
+	if h.config.UploadQueueTimeout <= 0 {
+		return nil, false
+	}
+
+	timer := time.NewTimer(h.config.UploadQueueTimeout)
+	defer timer.Stop()
+	select {
+	case h.uploadSlots <- struct{}{}:
+		return release, true
+	case <-timer.C:
+		return nil, false
+	case <-r.Context().Done():
+		return nil, false
+	}
 }
 
 func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
@@ -310,70 +979,186 @@ func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse multipart form
-	err := r.ParseMultipartForm(32 << 20) // 32 MB max
+	release, ok := h.acquireUploadSlot(r)
+	if !ok {
+		log.Printf("[UPLOAD REJECTED] All %d upload slots busy", h.config.MaxConcurrentUploads)
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many concurrent uploads, please retry later", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	// Uploads can legitimately outlive the server's read/write timeouts while the
+	// body arrives and chunks are embedded, so lift the deadlines for this request.
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("[UPLOAD WARNING] Could not clear read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[UPLOAD WARNING] Could not clear write deadline: %v", err)
+	}
+
+	// The file is type-checked as it arrives, before any of it is stored.
+	form, err := h.readUploadForm(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to parse form: %v", err), http.StatusBadRequest)
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			http.Error(w, ue.msg, ue.status)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	defer form.Close()
+	filename := form.filename
+
+	// In isolated mode each document gets its own collection so it can be
+	// searched and deleted independently of everything else.
+	collection := h.config.Collection
+	if form.FormValue("isolatePerFile") == "true" {
+		collection = collectionForFile(filename, maxCollectionName-len(h.config.chromaName("")))
+		if !validCollectionName(collection) {
+			http.Error(w, fmt.Sprintf("cannot derive a collection name from %q", filename), http.StatusBadRequest)
+			return
+		}
+	}
 
-	// Get file
-	file, header, err := r.FormFile("file")
+	// An identical file already in the collection is not ingested again unless forced.
+	fileHash, err := hashFile(form.src, form.size)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to get file: %v", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("failed to read file: %v", err), http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
+	if h.config.SkipDuplicateUploads && form.FormValue("force") != "true" {
+		existing, err := h.findIngestedFile(collection, fileHash)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to check for duplicate upload: %v", err), http.StatusBadGateway)
+			return
+		}
+		if existing != nil {
+			log.Printf("[UPLOAD SKIPPED] File: %s | Identical to already ingested %s (document %s)",
+				filename, existing.filename, existing.documentID)
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":     "already_ingested",
+				"filename":   existing.filename,
+				"collection": collection,
+				"documentId": existing.documentID,
+				"fileHash":   fileHash,
+			})
+			return
+		}
+	}
+
+	// A new document whose name is already in use is handled per FILENAME_COLLISION;
+	// appending to a document deliberately reuses its name.
+	appendTo := form.FormValue("appendTo")
+	if appendTo == "" {
+		name, err := h.resolveFilename(collection, filename)
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, errFilenameTaken) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if name != filename {
+			log.Printf("[UPLOAD RENAME] File: %s | Name in use, storing as %s", filename, name)
+			filename = name
+		}
+	}
+
+	doc := ingestDoc{
+		filename:   filename,
+		path:       normalizeDocPath(form.FormValue("path"), filename),
+		collection: collection,
+		documentID: uuid.New().String(),
+		fileHash:   fileHash,
+		password:   form.FormValue("password"),
+	}
+
+	// Appending continues an existing document's chunk numbering under its
+	// ID, filename and path.
+	if appendTo != "" {
+		stored, err := h.findStoredDocument(collection, appendTo)
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, errDocumentNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		doc.documentID = appendTo
+		doc.chunkOffset = stored.lastChunk
+		if stored.filename != "" {
+			doc.filename = stored.filename
+			doc.path = normalizeDocPath(stored.path, stored.filename)
+		}
+		log.Printf("[UPLOAD APPEND] File: %s | Document: %s (%s) | Continuing after chunk %d", filename, appendTo, doc.filename, stored.lastChunk)
+	}
 
 	// Log upload start with file details
 	log.Printf("[UPLOAD START] File: %s | Size: %d bytes (%.2f MB)",
-		header.Filename, header.Size, float64(header.Size)/(1024*1024))
+		filename, form.size, float64(form.size)/(1024*1024))
 
 	// Get chunk parameters
 	chunkSize := 100
 	chunkStride := 80
 
-	if cs := r.FormValue("chunkSize"); cs != "" {
+	if cs := form.FormValue("chunkSize"); cs != "" {
 		if parsed, err := strconv.Atoi(cs); err == nil && parsed > 0 {
 			chunkSize = parsed
 		}
 	}
 
-	if cst := r.FormValue("chunkStride"); cst != "" {
+	if cst := form.FormValue("chunkStride"); cst != "" {
 		if parsed, err := strconv.Atoi(cst); err == nil && parsed > 0 {
 			chunkStride = parsed
 		}
 	}
 
+	// A stride beyond the chunk size would skip the words in between.
+	if chunkStride > chunkSize {
+		chunkStride = chunkSize
+	}
+
 	// Get embedding model (default to config if not provided)
 	embeddingModel := h.config.DefaultModel
-	if em := r.FormValue("embeddingModel"); em != "" {
+	if em := form.FormValue("embeddingModel"); em != "" {
 		embeddingModel = em
 	}
 
 	log.Printf("[UPLOAD CONFIG] File: %s | Chunk size: %d words | Stride: %d words | Overlap: %d words | Model: %s",
-		header.Filename, chunkSize, chunkStride, chunkSize-chunkStride, embeddingModel)
+		filename, chunkSize, chunkStride, chunkSize-chunkStride, embeddingModel)
 
-	// Save file temporarily
-	tmpFile, err := os.CreateTemp("", "upload-*.pdf")
+	// Extraction and chunking fail with the upload's own status (an encrypted
+	// PDF, too many chunks), which can only be sent before progress streaming
+	// commits a 200.
+	extracted, err := h.extract(form.src, form.size, filename, doc.password, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to create temp file: %v", err), http.StatusInternalServerError)
+		log.Printf("[PDF ERROR] File: %s | Failed to read: %v", filename, err)
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			http.Error(w, ue.msg, ue.status)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to read file: %v", err), http.StatusUnprocessableEntity)
 		return
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
-
-	_, err = io.Copy(tmpFile, file)
+	chunked, err := h.chunkExtracted(extracted, doc, chunkSize, chunkStride)
 	if err != nil {
-		log.Printf("[UPLOAD ERROR] File: %s | Failed to save: %v", header.Filename, err)
-		http.Error(w, fmt.Sprintf("failed to save file: %v", err), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			status = ue.status
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
 
-	log.Printf("[UPLOAD SAVED] File: %s | Temp path: %s", header.Filename, tmpFile.Name())
-
-	// Process PDF
-	// Process PDF with progress updates
+	// Embed and store with progress updates
 	w.Header().Set("Content-Type", "application/x-ndjson")
 	w.Header().Set("Transfer-Encoding", "chunked")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -390,19 +1175,39 @@ func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		flusher.Flush()
 	}
 
-	err = h.processPDF(tmpFile.Name(), header.Filename, chunkSize, chunkStride, embeddingModel, progressFunc)
+	result, err := h.storeChunks(r.Context(), chunked, embeddingModel, progressFunc)
 	if err != nil {
 		log.Printf("Error processing PDF: %v", err)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		errResp := map[string]interface{}{"error": err.Error()}
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			// Headers are already sent by now, so the intended status travels in the payload.
+			errResp["code"] = ue.status
+		}
+		json.NewEncoder(w).Encode(errResp)
 		return
 	}
 
-	log.Printf("[UPLOAD COMPLETE] File: %s | Processing finished successfully", header.Filename)
+	log.Printf("[UPLOAD COMPLETE] File: %s | Processing finished successfully", filename)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":      "completed",
-		"filename":    header.Filename,
-		"chunkSize":   chunkSize,
-		"chunkStride": chunkStride,
+		"status":              "completed",
+		"filename":            doc.filename,
+		"path":                doc.path,
+		"collection":          collection,
+		"documentId":          doc.documentID,
+		"chunkSize":           chunkSize,
+		"chunkStride":         chunkStride,
+		"totalChunks":         result.TotalChunks,
+		"storedChunks":        result.StoredChunks,
+		"droppedChunks":       result.DroppedChunks,
+		"nearDuplicateChunks": result.NearDuplicateChunks,
+		"tableChunks":         result.TableChunks,
+		"failedChunks":        result.FailedChunks,
+		"embedFailurePolicy":  h.config.EmbedFailurePolicy,
+		"failures":            result.Failures,
+		"failuresTruncated":   result.FailuresTruncated,
+		"truncated":           result.Truncated,
+		"warnings":            result.Warnings,
 	})
 }
 
@@ -418,22 +1223,221 @@ func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	topK := defaultTopK
+	if k := r.URL.Query().Get("k"); k != "" {
+		if parsed, err := strconv.Atoi(k); err == nil && parsed > 0 && parsed <= maxTopK {
+			topK = parsed
+		}
+	}
+	rerank := r.URL.Query().Get("rerank") == "true"
+	diversify := r.URL.Query().Get("diversify") == "true"
+	includeEmbeddings := r.URL.Query().Get("includeEmbeddings") == "true"
+	collection, err := h.requestCollection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid fields parameter: %v", err), http.StatusBadRequest)
+		return
+	}
+	groupBy, err := parseGroupBy(r.URL.Query().Get("groupBy"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var since, until time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		if since, err = parseTimeParam("since", v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("until"); v != "" {
+		if until, err = parseTimeParam("until", v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	boost, err := h.requestBoost(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	raw := r.URL.Query().Get("raw") == "true"
+	if raw && (rerank || diversify || fields != nil || groupBy != "" || r.URL.Query().Has("boost")) {
+		http.Error(w, "raw cannot be combined with rerank, diversify, boost, fields or groupBy", http.StatusBadRequest)
+		return
+	}
+	lambda := defaultMMRLambda
+	if l := r.URL.Query().Get("lambda"); l != "" {
+		if parsed, err := strconv.ParseFloat(l, 64); err == nil && parsed >= 0 && parsed <= 1 {
+			lambda = parsed
+		}
+	}
+
 	log.Printf("Searching for: %s", query)
 
-	embedding, err := h.getEmbedding(query, h.config.DefaultModel)
+	embedding, err := h.embedQuery(r.Context(), query, h.config.DefaultModel)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to get embedding: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	results, err := h.queryChroma(embedding)
+	// Reranking and MMR work on a wider candidate pool and trim back to k afterwards.
+	nResults := topK
+	if rerank && h.config.RerankCandidates > nResults {
+		nResults = h.config.RerankCandidates
+	}
+	if diversify && h.config.MMRCandidates > nResults {
+		nResults = h.config.MMRCandidates
+	}
+	if boost.enabled() && !raw && h.config.BoostCandidates > nResults {
+		nResults = h.config.BoostCandidates
+	}
+
+	where := andFilters(pathPrefixFilter(r.URL.Query().Get("pathPrefix")), timeRangeFilter(since, until))
+	// Raw responses are Chroma's own for one collection, so they never fan out.
+	allCollections := !raw && h.searchesAllCollections(r)
+	var res *ChromaQueryResponse
+	var results []SearchResult
+	cacheKey := collection + "?" + r.URL.Query().Encode()
+	if allCollections {
+		cacheKey = "*?" + r.URL.Query().Encode()
+		results, err = h.searchAllCollections(r.Context(), embedding, nResults, diversify || includeEmbeddings, where)
+	} else {
+		res, err = h.queryChroma(r.Context(), collection, embedding, nResults, diversify || includeEmbeddings, where)
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to query chroma: %v", err), http.StatusInternalServerError)
+		if h.staleCache != nil && !errors.Is(err, ErrCollectionNotFound) {
+			if body, ok := h.staleCache.get(cacheKey); ok {
+				log.Printf("[SEARCH] Serving stale cached results after query failure: %v", err)
+				if raw {
+					w.Header().Set(searchFormatHeader, "chroma")
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("X-Cache", "stale")
+				w.Write(body)
+				return
+			}
+		}
+		http.Error(w, fmt.Sprintf("failed to query chroma: %v", err), collectionErrorStatus(err))
 		return
 	}
 
+	if raw {
+		// Chroma's own shape: parallel arrays nested once per query embedding,
+		// with distances but no scores.
+		w.Header().Set(searchFormatHeader, "chroma")
+		h.writeSearchResponse(w, cacheKey, res)
+		return
+	}
+
+	if !allCollections {
+		results = toSearchResults(res, 0, collection, h.score)
+	}
+	reranked := false
+	if rerank {
+		if out, err := h.rerankResults(query, results); err != nil {
+			log.Printf("[RERANK WARNING] Falling back to vector order: %v", err)
+		} else {
+			results = out
+			reranked = true
+		}
+	}
+	if boost.enabled() {
+		boost.apply(results)
+	}
+	if diversify {
+		results = diversifyMMR(embedding, results, topK, lambda)
+	}
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	if !includeEmbeddings {
+		// MMR needed the vectors, but they're too heavy to send unasked.
+		for i := range results {
+			results[i].Embedding = nil
+		}
+	}
+
+	var out interface{} = SearchResponse{
+		Query:       query,
+		Results:     results,
+		Reranked:    reranked,
+		Diversified: diversify,
+	}
+	if groupBy == "filename" {
+		out = GroupedSearchResponse{
+			Query:       query,
+			Groups:      groupByFilename(results, fields),
+			TotalHits:   len(results),
+			Reranked:    reranked,
+			Diversified: diversify,
+		}
+	} else if fields != nil {
+		projected := make([]map[string]interface{}, len(results))
+		for i, res := range results {
+			projected[i] = projectResult(res, fields)
+		}
+		out = ProjectedSearchResponse{
+			Query:       query,
+			Results:     projected,
+			Reranked:    reranked,
+			Diversified: diversify,
+		}
+	}
+
+	h.writeSearchResponse(w, cacheKey, out)
+}
+
+// searchFormatHeader tells clients which response shape /api/search returned
+// when it isn't the default flattened one.
+const searchFormatHeader = "X-Search-Format"
+
+// writeSearchResponse encodes a search response, keeping a copy in the stale
+// cache when it is enabled.
+func (h *Handler) writeSearchResponse(w http.ResponseWriter, cacheKey string, out interface{}) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(out); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if h.staleCache != nil {
+		h.staleCache.put(cacheKey, body.Bytes())
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	w.Write(body.Bytes())
+}
+
+// toSearchResults flattens query q's nested Chroma arrays into one result per hit.
+// Chroma may return fewer outer arrays than queries (or shorter inner arrays
+// than ids) for empty collections and error-shaped bodies, so every access is
+// bounds-checked and a missing query yields an empty, non-nil slice.
+func toSearchResults(res *ChromaQueryResponse, q int, collection string, score scoreFunc) []SearchResult {
+	results := []SearchResult{}
+	if res == nil || q < 0 || len(res.Ids) <= q {
+		return results
+	}
+	for i, id := range res.Ids[q] {
+		result := SearchResult{ID: id, Collection: collection}
+		if len(res.Documents) > q && i < len(res.Documents[q]) {
+			result.Document = res.Documents[q][i]
+		}
+		if len(res.Metadatas) > q && i < len(res.Metadatas[q]) {
+			result.Metadata, _ = res.Metadatas[q][i].(map[string]interface{})
+		}
+		if len(res.Distances) > q && i < len(res.Distances[q]) {
+			result.Distance = res.Distances[q][i]
+			result.Score = score(result.Distance)
+		}
+		if len(res.Embeddings) > q && i < len(res.Embeddings[q]) {
+			result.Embedding = res.Embeddings[q][i]
+		}
+		results = append(results, result)
+	}
+	return results
 }
 
 func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
@@ -444,10 +1448,13 @@ func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Fetching collection statistics")
 
-	// Get or create collection to ensure it exists
-	colID, err := h.getOrCreateCollection(h.config.Collection)
+	colID, err := h.collectionID(h.config.Collection)
 	if err != nil {
 		log.Printf("Failed to get collection: %v", err)
+		if errors.Is(err, ErrCollectionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		// Return empty stats if collection doesn't exist
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(StatsResponse{
@@ -459,24 +1466,9 @@ func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get collection count
-	countURL := fmt.Sprintf("%s%s/%s/count", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-	resp, err := http.Get(countURL)
+	count, err := h.countCollection(colID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to get count: %v", err), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		http.Error(w, fmt.Sprintf("chroma count error: %s", string(body)), http.StatusInternalServerError)
-		return
-	}
-
-	var count int
-	if err := json.NewDecoder(resp.Body).Decode(&count); err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode count: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -494,7 +1486,7 @@ func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
 			"include": []string{"metadatas"},
 		})
 
-		getResp, err := http.Post(getURL, "application/json", bytes.NewBuffer(reqBody))
+		getResp, err := h.storeClient.Post(getURL, "application/json", bytes.NewBuffer(reqBody))
 		if err == nil {
 			defer getResp.Body.Close()
 			if getResp.StatusCode == http.StatusOK {
@@ -543,9 +1535,9 @@ func (h *Handler) HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Deleting file: %s", filename)
 
 	// Get collection ID
-	colID, err := h.getOrCreateCollection(h.config.Collection)
+	colID, err := h.collectionID(h.config.Collection)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to get collection: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("failed to get collection: %v", err), collectionErrorStatus(err))
 		return
 	}
 
@@ -557,7 +1549,7 @@ func (h *Handler) HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
 	})
 
 	url := fmt.Sprintf("%s%s/%s/delete", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	resp, err := h.storeClient.Post(url, "application/json", bytes.NewBuffer(reqBody))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to delete: %v", err), http.StatusInternalServerError)
 		return
@@ -570,6 +1562,7 @@ func (h *Handler) HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.suggest.forget(h.config.Collection)
 	log.Printf("Successfully deleted file: %s", filename)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -580,18 +1573,92 @@ func (h *Handler) HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
 
 // Helpers
 
-func (h *Handler) processPDF(path, filename string, chunkSize, chunkStride int, embeddingModel string, progress func(string)) error {
-	log.Printf("[PDF PROCESSING START] File: %s | Path: %s", filename, path)
+// ingestDoc identifies the document an upload's chunks are stored as.
+type ingestDoc struct {
+	filename   string
+	path       string
+	collection string
+	documentID string
+	// chunkOffset is the last chunk number already stored for documentID (0 for a new document).
+	chunkOffset int
+	// title, author and created describe the document itself, from its metadata.
+	title   string
+	author  string
+	created time.Time
+	// fileHash is the SHA-256 of the uploaded file ("" for text ingested as JSON).
+	fileHash string
+	// sourceURL is where a document ingested from a URL was fetched from.
+	sourceURL string
+	// tags are stored comma-joined as the chunks' "tags" metadata.
+	tags []string
+	// password decrypts a password-protected PDF; it is never stored.
+	password string
+}
+
+func (h *Handler) processPDF(ctx context.Context, src io.ReaderAt, size int64, doc ingestDoc, chunkSize, chunkStride int, embeddingModel string, progress func(string)) (*IngestResult, error) {
+	filename := doc.filename
+	log.Printf("[PDF PROCESSING START] File: %s | Size: %d bytes", filename, size)
 
 	if progress != nil {
-		progress("Reading PDF file...")
+		progress("Reading file...")
 	}
 
-	content, err := ReadPDF(path, filename, progress)
+	extracted, err := h.extract(src, size, filename, doc.password, progress)
 	if err != nil {
 		log.Printf("[PDF ERROR] File: %s | Failed to read: %v", filename, err)
-		return fmt.Errorf("failed to read PDF: %v", err)
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	return h.ingestExtracted(ctx, extracted, doc, chunkSize, chunkStride, embeddingModel, progress)
+}
+
+// extract runs the extractor for filename's type: plain text files are read
+// as is, anything else as a PDF.
+func (h *Handler) extract(src io.ReaderAt, size int64, filename, password string, progress func(string)) (*PDFText, error) {
+	if isPlainText(strings.ToLower(filepath.Ext(filename))) {
+		return ReadText(src, size)
+	}
+	return ReadPDF(src, size, filename, PDFOptions{
+		Password:      password,
+		ExtractTables: h.config.ExtractTables,
+		Dehyphenate:   h.config.Dehyphenate,
+	}, progress)
+}
+
+// ingestExtracted chunks extracted text, embeds the chunks and stores them
+// in the document's collection.
+func (h *Handler) ingestExtracted(ctx context.Context, extracted *PDFText, doc ingestDoc, chunkSize, chunkStride int, embeddingModel string, progress func(string)) (*IngestResult, error) {
+	c, err := h.chunkExtracted(extracted, doc, chunkSize, chunkStride)
+	if err != nil {
+		return nil, err
+	}
+	return h.storeChunks(ctx, c, embeddingModel, progress)
+}
+
+// chunkedDoc is a document split into chunks, ready to be embedded and stored.
+type chunkedDoc struct {
+	// doc carries the title, author and creation time of the extracted text.
+	doc     ingestDoc
+	pending []pendingChunk
+	result  *IngestResult
+	// chars is the length of the extracted text.
+	chars int
+}
+
+// chunkExtracted splits extracted text into the chunks to store, applying the
+// short-chunk, near-duplicate and MAX_CHUNKS_PER_DOC rules. It makes no
+// upstream calls, so uploads run it before their response is committed.
+func (h *Handler) chunkExtracted(extracted *PDFText, doc ingestDoc, chunkSize, chunkStride int) (*chunkedDoc, error) {
+	filename := doc.filename
+	if h.config.NormalizeText {
+		normalizeExtracted(extracted)
 	}
+	content := extracted.Text
+	doc.title, doc.author, doc.created = extracted.Title, extracted.Author, extracted.Created
 
 	// Report extracted content size
 	contentLen := len(content)
@@ -599,68 +1666,331 @@ func (h *Handler) processPDF(path, filename string, chunkSize, chunkStride int,
 	log.Printf("[PDF EXTRACTION] File: %s | Extracted: %d chars | Trimmed: %d chars",
 		filename, contentLen, trimmedLen)
 
-	if progress != nil {
-		progress(fmt.Sprintf("Extracted %d characters from PDF", contentLen))
-	}
-
 	if trimmedLen == 0 {
 		log.Printf("[PDF ERROR] File: %s | No text content extracted (possibly scanned/image-based PDF)", filename)
-		return fmt.Errorf("no text content extracted from PDF (file might be scanned or image-based)")
-	}
-
-	if progress != nil {
-		progress("Splitting text into chunks...")
+		return nil, &uploadError{
+			status: http.StatusUnprocessableEntity,
+			msg:    "no text content extracted from PDF (file might be scanned or image-based)",
+		}
 	}
 
-	chunks := ChunkText(content, chunkSize, chunkStride)
+	words := strings.Fields(content)
+	chunks := chunkWords(words, chunkSize, chunkStride)
 	log.Printf("[PDF CHUNKING] File: %s | Total chunks: %d | Chunk size: %d words | Stride: %d words",
 		filename, len(chunks), chunkSize, chunkStride)
 
+	dropped := 0
+	if h.config.MinChunkWords > 0 {
+		chunks, dropped = filterShortChunks(words, chunks, h.config.MinChunkWords, h.config.MergeShortChunks)
+		if dropped > 0 {
+			log.Printf("[PDF CHUNKING] File: %s | Removed %d chunks under %d words", filename, dropped, h.config.MinChunkWords)
+		}
+	}
+
 	if len(chunks) == 0 {
 		log.Printf("[PDF ERROR] File: %s | Resulted in 0 chunks (text too short)", filename)
-		return fmt.Errorf("resulted in 0 chunks (text might be too short)")
+		return nil, &uploadError{status: http.StatusUnprocessableEntity, msg: "resulted in 0 chunks (text might be too short)"}
 	}
 
-	if progress != nil {
-		progress(fmt.Sprintf("Created %d chunks - Starting embedding...", len(chunks)))
+	nearDups := 0
+	if h.config.NearDupThreshold > 0 {
+		chunks, nearDups = filterNearDuplicates(chunks, h.config.NearDupThreshold, h.config.NearDupWindow)
+		if nearDups > 0 {
+			log.Printf("[PDF CHUNKING] File: %s | Skipped %d near-duplicate chunks (threshold %.2f)", filename, nearDups, h.config.NearDupThreshold)
+		}
 	}
 
-	for i, chunk := range chunks {
-		msg := fmt.Sprintf("Processing chunk %d/%d", i+1, len(chunks))
-		if progress != nil {
-			progress(msg)
+	var tableChunks []pendingChunk
+	for _, t := range extracted.Tables {
+		for _, text := range t.markdownChunks(chunkSize) {
+			tableChunks = append(tableChunks, pendingChunk{text: text, page: t.page, pageEnd: t.page, kind: chunkTable})
+		}
+	}
+	if len(tableChunks) > 0 {
+		log.Printf("[PDF TABLES] File: %s | Tables: %d | Table chunks: %d", filename, len(extracted.Tables), len(tableChunks))
+	}
+
+	result := &IngestResult{
+		TotalChunks:         len(chunks) + len(tableChunks),
+		TableChunks:         len(tableChunks),
+		DroppedChunks:       dropped,
+		NearDuplicateChunks: nearDups,
+	}
+
+	// The limit covers table chunks too; truncation keeps text chunks first.
+	if limit := h.config.MaxChunksPerDoc; limit > 0 && result.TotalChunks > limit {
+		if !h.config.TruncateOversized {
+			log.Printf("[PDF ERROR] File: %s | %d chunks exceeds limit of %d", filename, result.TotalChunks, limit)
+			return nil, &uploadError{
+				status: http.StatusRequestEntityTooLarge,
+				msg:    fmt.Sprintf("document produced %d chunks, exceeding the limit of %d", result.TotalChunks, limit),
+			}
 		}
-		log.Printf("[CHUNK PROCESSING] File: %s | Chunk: %d/%d | Length: %d chars",
-			filename, i+1, len(chunks), len(chunk))
+		warning := fmt.Sprintf("document produced %d chunks; only the first %d were ingested", result.TotalChunks, limit)
+		log.Printf("[PDF WARNING] File: %s | %s", filename, warning)
+		if len(chunks) > limit {
+			chunks = chunks[:limit]
+		}
+		tableChunks = tableChunks[:limit-len(chunks)]
+		result.Truncated = true
+		result.Warnings = append(result.Warnings, warning)
+	}
+
+	pending := make([]pendingChunk, 0, len(chunks)+len(tableChunks))
+	for _, chunk := range chunks {
+		pending = append(pending, pendingChunk{
+			text:    chunk.Text,
+			page:    extracted.PageForWord(chunk.StartWord),
+			pageEnd: extracted.PageForWord(chunk.EndWord - 1),
+			kind:    chunkText,
+		})
+	}
+	pending = append(pending, tableChunks...)
+
+	return &chunkedDoc{doc: doc, pending: pending, result: result, chars: contentLen}, nil
+}
+
+// storeChunks embeds a chunked document and stores it in its collection.
+func (h *Handler) storeChunks(ctx context.Context, c *chunkedDoc, embeddingModel string, progress func(string)) (*IngestResult, error) {
+	doc, pending, result := c.doc, c.pending, c.result
+	filename := doc.filename
+	total := len(pending)
 
-		embedding, err := h.getEmbedding(chunk, embeddingModel)
+	if progress != nil {
+		progress(fmt.Sprintf("Extracted %d characters", c.chars))
+		for _, warning := range result.Warnings {
+			progress("Warning: " + warning)
+		}
+		progress(fmt.Sprintf("Created %d chunks - Starting embedding...", total))
+	}
+
+	// Embedded chunks are buffered and written to Chroma in batches. The deferred
+	// flush guarantees nothing already embedded is lost on an early return.
+	batch := make([]pendingChunk, 0, h.config.ChromaBatchSize)
+	lastFlush := time.Now()
+	retries := h.newUploadRetries()
+	// aborted is set once a storage failure exhausts the upload's retry budget.
+	var aborted error
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		first, last := batch[0].chunkNum, batch[len(batch)-1].chunkNum
+		// A split add can store a prefix of the batch before failing, so
+		// retries only resend what is still missing.
+		stored := 0
+		err := retries.do(ctx, "storage", func() error {
+			n, err := h.addToChroma(batch[stored:], doc)
+			stored += n
+			return err
+		})
+		result.StoredChunks += stored
 		if err != nil {
-			log.Printf("[CHUNK WARNING] File: %s | Chunk: %d/%d | Embedding failed: %v",
-				filename, i+1, len(chunks), err)
-			continue
+			log.Printf("[CHUNK WARNING] File: %s | Chunks: %d-%d | Storage failed after storing %d: %v",
+				filename, first, last, stored, err)
+			if budgetExhausted(err) && aborted == nil {
+				aborted = err
+			}
+			for _, c := range batch[stored:] {
+				result.addFailure(c.chunkNum, "storage", err)
+			}
+		} else {
+			log.Printf("[CHUNK SUCCESS] File: %s | Stored chunks: %d-%d/%d", filename, first, last, total)
+		}
+		batch = batch[:0]
+		lastFlush = time.Now()
+	}
+	defer flush()
+
+	// Chunks are embedded embedBatchSize at a time; a size of 1 keeps the
+	// single-text endpoint and its per-chunk failure isolation.
+	embedBatch := h.embedBatchSize(embeddingModel)
+	for start := 0; start < len(pending); start += embedBatch {
+		if err := ctx.Err(); err != nil {
+			log.Printf("[PDF CANCELLED] File: %s | Stopped at chunk %d/%d: %v", filename, start+1, total, err)
+			flush()
+			return nil, fmt.Errorf("upload cancelled after %d/%d chunks", start, total)
 		}
 
-		err = h.addToChroma(chunk, embedding, filename, i+1)
+		group := pending[start:min(start+embedBatch, len(pending))]
+		inputs := make([]string, len(group))
+		for j, chunk := range group {
+			i := start + j
+			msg := fmt.Sprintf("Processing chunk %d/%d", i+1, total)
+			if progress != nil {
+				progress(msg)
+			}
+			log.Printf("[CHUNK PROCESSING] File: %s | Chunk: %d/%d | Length: %d chars",
+				filename, i+1, total, len(chunk.text))
+			inputs[j] = h.embedText(doc, doc.title, chunk.page, chunk.text)
+		}
+
+		var embeddings [][]float32
+		err := retries.do(ctx, "embedding", func() error {
+			if len(inputs) == 1 {
+				embedding, err := h.embedDocument(ctx, inputs[0], embeddingModel)
+				embeddings = [][]float32{embedding}
+				return err
+			}
+			var err error
+			embeddings, err = h.getEmbeddings(ctx, inputs, embeddingModel, purposeDocument)
+			return err
+		})
 		if err != nil {
-			log.Printf("[CHUNK WARNING] File: %s | Chunk: %d/%d | Storage failed: %v",
-				filename, i+1, len(chunks), err)
+			log.Printf("[CHUNK WARNING] File: %s | Chunks: %d-%d/%d | Embedding failed: %v",
+				filename, start+1, start+len(group), total, err)
+			if budgetExhausted(err) {
+				return nil, err
+			}
+			result.FailedChunks += len(group)
+			for j := range group {
+				result.addFailure(doc.chunkOffset+start+j+1, "embedding", err)
+			}
+			if err := h.checkEmbedFailures(result.FailedChunks, total, err); err != nil {
+				log.Printf("[PDF ERROR] File: %s | %v", filename, err)
+				return nil, err
+			}
 			continue
 		}
 
-		log.Printf("[CHUNK SUCCESS] File: %s | Stored chunk: %d/%d", filename, i+1, len(chunks))
+		for j, chunk := range group {
+			chunk.embedding = embeddings[j]
+			chunk.chunkNum = doc.chunkOffset + start + j + 1
+			batch = append(batch, chunk)
+			if len(batch) >= h.config.ChromaBatchSize ||
+				(h.config.ChromaFlushInterval > 0 && time.Since(lastFlush) >= h.config.ChromaFlushInterval) {
+				flush()
+				if aborted != nil {
+					return nil, aborted
+				}
+			}
+		}
+	}
+	flush()
+	if aborted != nil {
+		return nil, aborted
+	}
+	if result.FailedChunks > 0 {
+		warning := fmt.Sprintf("%d of %d chunks could not be embedded and were skipped", result.FailedChunks, total)
+		log.Printf("[PDF WARNING] File: %s | %s", filename, warning)
+		result.Warnings = append(result.Warnings, warning)
+	}
+
+	log.Printf("[PDF PROCESSING COMPLETE] File: %s | Total chunks: %d", filename, total)
+	return result, nil
+}
+
+// embedPurpose tells getEmbedding whether the text is being ingested or searched for.
+type embedPurpose int
+
+const (
+	purposeDocument embedPurpose = iota
+	purposeQuery
+)
+
+// embedDocument embeds a chunk of ingested text.
+func (h *Handler) embedDocument(ctx context.Context, text, model string) ([]float32, error) {
+	return h.getEmbedding(ctx, text, model, purposeDocument)
+}
+
+// embedQuery embeds a search query. Asymmetric models score queries against
+// documents, so the two sides can get different prefixes; with no prefixes
+// configured both produce identical vectors. Every query goes through
+// prepareQuery first, so search, batch search and ask embed a question alike.
+func (h *Handler) embedQuery(ctx context.Context, text, model string) ([]float32, error) {
+	return h.getEmbedding(ctx, h.logPreparedQuery(text), model, purposeQuery)
+}
+
+// embedQueries embeds several search queries like embedQuery, sending them
+// embedBatchSize at a time.
+func (h *Handler) embedQueries(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	size := h.embedBatchSize(model)
+	for start := 0; start < len(texts); start += size {
+		group := texts[start:min(start+size, len(texts))]
+		prepared := make([]string, len(group))
+		for i, text := range group {
+			prepared[i] = h.logPreparedQuery(text)
+		}
+		batch, err := h.getEmbeddings(ctx, prepared, model, purposeQuery)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+// logPreparedQuery returns prepareQuery(text), logging it when it differs.
+func (h *Handler) logPreparedQuery(text string) string {
+	prepared := h.prepareQuery(text)
+	if prepared != text {
+		log.Printf("[QUERY] %q embedded as %q", text, prepared)
 	}
+	return prepared
+}
 
-	log.Printf("[PDF PROCESSING COMPLETE] File: %s | Total chunks: %d", filename, len(chunks))
+func (h *Handler) embedPrefix(purpose embedPurpose) string {
+	if purpose == purposeQuery {
+		return h.config.QueryPrefix
+	}
+	return h.config.DocumentPrefix
+}
+
+// parseEmbedOptions reads EMBED_OPTIONS, a JSON object of Ollama model
+// options. "truncate" is a top-level request field rather than a model
+// option, so it is split out into EmbedTruncate.
+func (c *Config) parseEmbedOptions(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	var opts map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &opts); err != nil {
+		return fmt.Errorf("invalid JSON object: %w", err)
+	}
+	if v, ok := opts["truncate"]; ok {
+		truncate, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("truncate must be a boolean, got %v", v)
+		}
+		c.EmbedTruncate = &truncate
+		delete(opts, "truncate")
+	}
+	if len(opts) > 0 {
+		c.EmbedOptions = opts
+	}
 	return nil
 }
 
-func (h *Handler) getEmbedding(text string, model string) ([]float32, error) {
+func (h *Handler) getEmbedding(ctx context.Context, text string, model string, purpose embedPurpose) ([]float32, error) {
+	// The legacy /api/embeddings endpoint ignores "truncate", so honor it via /api/embed.
+	if h.config.EmbedTruncate != nil {
+		embeddings, err := h.getEmbeddings(ctx, []string{text}, model, purpose)
+		if err != nil {
+			return nil, err
+		}
+		return embeddings[0], nil
+	}
+
+	prefix := h.embedPrefix(purpose)
+
 	reqBody, _ := json.Marshal(EmbeddingRequest{
-		Model:  model,
-		Prompt: text,
+		Model:   model,
+		Prompt:  prefix + text,
+		Options: h.config.EmbedOptions,
 	})
 
-	resp, err := http.Post(h.config.OllamaURL+"/api/embeddings", "application/json", bytes.NewBuffer(reqBody))
+	release, err := h.acquireEmbedSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.OllamaURL+"/api/embeddings", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.embedClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("http post error: %w", err)
 	}
@@ -675,57 +2005,242 @@ func (h *Handler) getEmbedding(text string, model string) ([]float32, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	if err := h.checkDimension(res.Embedding, model); err != nil {
+		return nil, err
+	}
 
-	return res.Embedding, nil
+	return truncateDims(res.Embedding, h.config.EmbedDim), nil
 }
 
-func (h *Handler) addToChroma(text string, embedding []float32, filename string, chunkNum int) error {
-	colID, err := h.getOrCreateCollection(h.config.Collection)
-	if err != nil {
-		return fmt.Errorf("getOrCreateCollection failed: %w", err)
+// checkDimension rejects vectors that can't have come from the intended
+// embedding model: empty ones always, and ones whose length differs from
+// EXPECTED_DIM when it is set. A chat model configured by mistake otherwise
+// produces garbage that is silently stored.
+func (h *Handler) checkDimension(embedding []float32, model string) error {
+	if len(embedding) == 0 {
+		return fmt.Errorf("model %s returned an empty embedding (is it an embedding model?)", model)
+	}
+	if h.config.ExpectedDim > 0 && len(embedding) != h.config.ExpectedDim {
+		return fmt.Errorf("model %s returned a %d-dimensional embedding, expected %d (check EMBEDDING_MODELS / EXPECTED_DIM)",
+			model, len(embedding), h.config.ExpectedDim)
 	}
+	return nil
+}
 
-	id := uuid.New().String()
-	reqBody, _ := json.Marshal(ChromaAddRequest{
-		Documents: []string{text},
-		Metadatas: []interface{}{map[string]interface{}{
-			"source":      "pdf",
-			"filename":    filename,
-			"chunk_num":   chunkNum,
-			"uploaded_at": time.Now().Format(time.RFC3339),
-		}},
-		Ids:        []string{id},
-		Embeddings: [][]float32{embedding},
+// getEmbeddings embeds several texts in one call using Ollama's batch /api/embed endpoint.
+// The returned vectors are in the same order as texts.
+func (h *Handler) getEmbeddings(ctx context.Context, texts []string, model string, purpose embedPurpose) ([][]float32, error) {
+	prefix := h.embedPrefix(purpose)
+	input := make([]string, len(texts))
+	for i, text := range texts {
+		input[i] = prefix + text
+	}
+
+	reqBody, _ := json.Marshal(BatchEmbeddingRequest{
+		Model:    model,
+		Input:    input,
+		Options:  h.config.EmbedOptions,
+		Truncate: h.config.EmbedTruncate,
 	})
 
-	url := fmt.Sprintf("%s%s/%s/add", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	release, err := h.acquireEmbedSlot(ctx)
 	if err != nil {
-		return fmt.Errorf("http post to %s failed: %w", url, err)
+		return nil, err
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.OllamaURL+"/api/embed", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.embedClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http post error: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
+	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("chroma add returned status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, string(body))
 	}
 
-	return nil
+	var res BatchEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(res.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(res.Embeddings), len(texts))
+	}
+
+	for i, embedding := range res.Embeddings {
+		if err := h.checkDimension(embedding, model); err != nil {
+			return nil, err
+		}
+		res.Embeddings[i] = truncateDims(embedding, h.config.EmbedDim)
+	}
+
+	return res.Embeddings, nil
+}
+
+// acquireEmbedSlot blocks until fewer than OLLAMA_MAX_CONCURRENCY embedding
+// calls are in flight across all requests, or ctx is done. The returned func
+// releases the slot.
+func (h *Handler) acquireEmbedSlot(ctx context.Context) (func(), error) {
+	if h.embedSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case h.embedSlots <- struct{}{}:
+		return func() { <-h.embedSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// pendingChunk is an embedded chunk waiting to be written to Chroma.
+type pendingChunk struct {
+	text      string
+	embedding []float32
+	chunkNum  int
+	page      int
+	pageEnd   int
+	kind      string
 }
 
-func (h *Handler) queryChroma(embedding []float32) (*ChromaQueryResponse, error) {
-	colID, err := h.getOrCreateCollection(h.config.Collection)
+// Values of the "type" chunk metadata.
+const (
+	chunkText  = "text"
+	chunkTable = "table"
+)
+
+// addToChroma stores the embedded chunks, returning how many of them were
+// stored. On error those are a prefix of chunks.
+func (h *Handler) addToChroma(chunks []pendingChunk, doc ingestDoc) (int, error) {
+	colID, err := h.getOrCreateCollection(doc.collection)
+	if err != nil {
+		return 0, fmt.Errorf("getOrCreateCollection failed: %w", err)
+	}
+
+	now := time.Now()
+	uploadedAt := now.Format(time.RFC3339)
+	ingestedAt := now.UTC().Format(time.RFC3339)
+	req := ChromaAddRequest{
+		Documents:  make([]string, 0, len(chunks)),
+		Metadatas:  make([]interface{}, 0, len(chunks)),
+		Ids:        make([]string, 0, len(chunks)),
+		Embeddings: make([][]float32, 0, len(chunks)),
+	}
+	for _, c := range chunks {
+		req.Documents = append(req.Documents, c.text)
+		meta := map[string]interface{}{
+			"source":      "pdf",
+			"filename":    doc.filename,
+			"document_id": doc.documentID,
+			"chunk_num":   c.chunkNum,
+			"page":        c.page,
+			"page_end":    c.pageEnd,
+			"type":        c.kind,
+			"uploaded_at": uploadedAt,
+			"ingested_at": ingestedAt,
+			// Numeric copy of ingested_at for since/until filtering.
+			ingestedAtUnixKey: now.Unix(),
+		}
+		if doc.fileHash != "" {
+			meta["file_hash"] = doc.fileHash
+		}
+		addDocumentMetadata(meta, doc)
+		addPathMetadata(meta, doc.path)
+		if doc.sourceURL != "" {
+			meta["source_url"] = doc.sourceURL
+		}
+		if len(doc.tags) > 0 {
+			meta["tags"] = strings.Join(doc.tags, ",")
+		}
+		req.Metadatas = append(req.Metadatas, meta)
+		req.Ids = append(req.Ids, uuid.New().String())
+		req.Embeddings = append(req.Embeddings, c.embedding)
+	}
+
+	url := fmt.Sprintf("%s%s/%s/add", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
+	stored, err := h.sendChromaAdd(url, req)
+	if stored > 0 {
+		h.suggest.record(doc.collection, req.Documents[:stored])
+	}
+	return stored, err
+}
+
+func (h *Handler) queryChroma(ctx context.Context, collection string, embedding []float32, nResults int, withEmbeddings bool, where map[string]interface{}) (*ChromaQueryResponse, error) {
+	return h.queryChromaMulti(ctx, collection, [][]float32{embedding}, nResults, withEmbeddings, where)
+}
+
+// queryChromaMulti runs several query embeddings in one request; Chroma returns
+// one nested result array per embedding, in order. A non-nil where restricts
+// matches by metadata. Transient failures are retried with exponential backoff
+// until ctx is done.
+func (h *Handler) queryChromaMulti(ctx context.Context, collection string, embeddings [][]float32, nResults int, withEmbeddings bool, where map[string]interface{}) (*ChromaQueryResponse, error) {
+	backoff := h.config.QueryRetryBackoff
+	for attempt := 0; ; attempt++ {
+		res, err := h.queryChromaOnce(ctx, collection, embeddings, nResults, withEmbeddings, where)
+		if err == nil || attempt >= h.config.QueryRetries || !retryableQueryError(err) || ctx.Err() != nil {
+			return res, err
+		}
+		log.Printf("[QUERY RETRY] Attempt %d/%d failed, retrying in %s: %v", attempt+1, h.config.QueryRetries+1, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// chromaStatusError is a non-2xx response from Chroma's query endpoint.
+type chromaStatusError struct {
+	status int
+	body   string
+}
+
+func (e *chromaStatusError) Error() string {
+	return fmt.Sprintf("chroma query returned status %d: %s", e.status, e.body)
+}
+
+// retryableQueryError reports whether a query failure may succeed on retry:
+// network errors and 5xx responses are, a missing collection or a rejected request are not.
+func retryableQueryError(err error) bool {
+	if errors.Is(err, ErrCollectionNotFound) {
+		return false
+	}
+	var se *chromaStatusError
+	if errors.As(err, &se) {
+		return se.status >= 500
+	}
+	return true
+}
+
+func (h *Handler) queryChromaOnce(ctx context.Context, collection string, embeddings [][]float32, nResults int, withEmbeddings bool, where map[string]interface{}) (*ChromaQueryResponse, error) {
+	colID, err := h.collectionID(collection)
 	if err != nil {
 		return nil, err
 	}
 
-	reqBody, _ := json.Marshal(ChromaQueryRequest{
-		QueryEmbeddings: [][]float32{embedding},
-		NResults:        5,
-	})
+	query := ChromaQueryRequest{
+		QueryEmbeddings: embeddings,
+		NResults:        nResults,
+		Where:           where,
+	}
+	if withEmbeddings {
+		// Setting include replaces Chroma's defaults, so list everything we use.
+		query.Include = []string{"documents", "metadatas", "distances", "embeddings"}
+	}
+	reqBody, _ := json.Marshal(query)
 
 	url := fmt.Sprintf("%s%s/%s/query", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.storeClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -733,38 +2248,131 @@ func (h *Handler) queryChroma(embedding []float32) (*ChromaQueryResponse, error)
 
 	if resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("chroma query returned status %d: %s", resp.StatusCode, string(body))
+		return nil, &chromaStatusError{status: resp.StatusCode, body: string(body)}
 	}
 
 	var res ChromaQueryResponse
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
 		return nil, err
 	}
+	// Searching before anything is uploaded hits a freshly created, empty
+	// collection, for which Chroma may return empty or missing arrays.
+	padQueryResponse(&res, len(embeddings))
 
 	return &res, nil
 }
 
+// padQueryResponse gives res a (possibly empty) list of ids, documents,
+// metadatas and distances for each of n queries, so raw responses are
+// well-formed whatever shape Chroma answered with.
+func padQueryResponse(res *ChromaQueryResponse, n int) {
+	for len(res.Ids) < n {
+		res.Ids = append(res.Ids, nil)
+	}
+	for len(res.Documents) < n {
+		res.Documents = append(res.Documents, nil)
+	}
+	for len(res.Metadatas) < n {
+		res.Metadatas = append(res.Metadatas, nil)
+	}
+	for len(res.Distances) < n {
+		res.Distances = append(res.Distances, nil)
+	}
+	for i := 0; i < n; i++ {
+		if res.Ids[i] == nil {
+			res.Ids[i] = []string{}
+		}
+		if res.Documents[i] == nil {
+			res.Documents[i] = []string{}
+		}
+		if res.Metadatas[i] == nil {
+			res.Metadatas[i] = []interface{}{}
+		}
+		if res.Distances[i] == nil {
+			res.Distances[i] = []float32{}
+		}
+	}
+}
+
+// countCollection returns the number of records stored in the collection.
+func (h *Handler) countCollection(colID string) (int, error) {
+	countURL := fmt.Sprintf("%s%s/%s/count", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
+	resp, err := h.storeClient.Get(countURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get count: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("chroma count error: %s", string(body))
+	}
+
+	var count int
+	if err := json.NewDecoder(resp.Body).Decode(&count); err != nil {
+		return 0, fmt.Errorf("failed to decode count: %w", err)
+	}
+	return count, nil
+}
+
+// ErrCollectionNotFound is returned by read paths when the collection doesn't
+// exist and AUTO_CREATE_COLLECTIONS is disabled.
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// collectionErrorStatus maps a collection lookup failure to an HTTP status.
+func collectionErrorStatus(err error) int {
+	if errors.Is(err, ErrCollectionNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// collectionID resolves a collection for reading, creating it only when
+// AutoCreateCollections is enabled.
+func (h *Handler) collectionID(name string) (string, error) {
+	if h.config.AutoCreateCollections {
+		return h.getOrCreateCollection(name)
+	}
+	return h.findCollection(name)
+}
+
+// findCollection looks up an existing collection without creating it.
+func (h *Handler) findCollection(name string) (string, error) {
+	getURL := fmt.Sprintf("%s%s/%s", h.config.ChromaURL, h.config.ChromaAPIBase, h.config.chromaName(name))
+	resp, err := h.storeClient.Get(getURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to GET %s: %w", getURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("get collection at %s returned status %d: %s", getURL, resp.StatusCode, string(body))
+	}
+
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("failed to decode get collection response: %w", err)
+	}
+	return res.ID, nil
+}
+
 func (h *Handler) getOrCreateCollection(name string) (string, error) {
 	// 1. Try to get
-	getURL := fmt.Sprintf("%s%s/%s", h.config.ChromaURL, h.config.ChromaAPIBase, name)
-	resp, err := http.Get(getURL)
-	if err == nil {
-		defer resp.Body.Close()
-		if resp.StatusCode == http.StatusOK {
-			var res struct {
-				ID string `json:"id"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-				return "", fmt.Errorf("failed to decode get collection response: %w", err)
-			}
-			return res.ID, nil
-		}
+	if id, err := h.findCollection(name); err == nil {
+		return id, nil
 	}
 
 	// 2. Create if not found or status not OK
 	createURL := fmt.Sprintf("%s%s", h.config.ChromaURL, h.config.ChromaAPIBase)
-	reqBody, _ := json.Marshal(map[string]string{"name": name})
-	resp, err = http.Post(createURL, "application/json", bytes.NewBuffer(reqBody))
+	reqBody, _ := json.Marshal(map[string]string{"name": h.config.chromaName(name)})
+	resp, err := h.storeClient.Post(createURL, "application/json", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return "", fmt.Errorf("failed to POST to %s: %w", createURL, err)
 	}
@@ -789,19 +2397,56 @@ func (h *Handler) getOrCreateCollection(name string) (string, error) {
 	return res.ID, nil
 }
 
-// ReadPDF extracts plain text from a PDF file at the given path.
-func ReadPDF(path, filename string, progress func(string)) (string, error) {
-	f, r, err := pdf.Open(path)
+// PDFText is the plain text extracted from a PDF along with where each page begins.
+type PDFText struct {
+	Text string
+	// Title is the document's own title, if one could be extracted.
+	Title string
+	// Author and Created come from the PDF's information dictionary, when present.
+	Author  string
+	Created time.Time
+	// Tables are the tables detected when table extraction is enabled.
+	Tables []pdfTable
+	// PageWordStarts[i] is the index in strings.Fields(Text) of the first word of page i+1.
+	PageWordStarts []int
+}
+
+// PageForWord returns the 1-based page containing the given word index.
+func (t *PDFText) PageForWord(word int) int {
+	page := sort.Search(len(t.PageWordStarts), func(i int) bool {
+		return t.PageWordStarts[i] > word
+	})
+	if page == 0 {
+		return 1
+	}
+	return page
+}
+
+// PDFOptions controls how ReadPDF extracts a PDF.
+type PDFOptions struct {
+	// Password decrypts an encrypted PDF.
+	Password string
+	// ExtractTables also looks for tables on every page.
+	ExtractTables bool
+	// Dehyphenate rejoins words broken across lines with a hyphen.
+	Dehyphenate bool
+}
+
+// ReadPDF extracts plain text from a PDF of the given size read from src.
+func ReadPDF(src io.ReaderAt, size int64, filename string, opts PDFOptions, progress func(string)) (*PDFText, error) {
+	r, err := openPDF(src, size, opts.Password)
 	if err != nil {
 		log.Printf("[PDF OPEN ERROR] File: %s | Error: %v", filename, err)
-		return "", err
+		return nil, err
 	}
-	defer f.Close()
 
 	total := r.NumPage()
 	log.Printf("[PDF READING] File: %s | Total pages: %d", filename, total)
 
-	var buf bytes.Buffer
+	// Pages are collected first so dehyphenation can consult the whole
+	// document; skipped pages stay nil.
+	pages := make([]*string, total)
+	var tables []pdfTable
 
 	for i := 1; i <= total; i++ {
 		// Report progress more frequently for large PDFs
@@ -818,13 +2463,22 @@ func ReadPDF(path, filename string, progress func(string)) (string, error) {
 		}
 
 		type pageResult struct {
-			text string
-			err  error
+			text   string
+			tables []pdfTable
+			err    error
 		}
 		ch := make(chan pageResult, 1)
+		page := i
 		go func() {
 			text, err := p.GetPlainText(nil)
-			ch <- pageResult{text, err}
+			var found []pdfTable
+			if err == nil && opts.ExtractTables {
+				// A page whose layout can't be read still contributes its plain text.
+				if rows, rowErr := p.GetTextByRow(); rowErr == nil {
+					found = detectTables(rows, page)
+				}
+			}
+			ch <- pageResult{text, found, err}
 		}()
 
 		select {
@@ -833,7 +2487,8 @@ func ReadPDF(path, filename string, progress func(string)) (string, error) {
 				log.Printf("[PDF PAGE ERROR] File: %s | Page: %d/%d | Error: %v", filename, i, total, res.err)
 				continue
 			}
-			buf.WriteString(res.text)
+			pages[i-1] = &res.text
+			tables = append(tables, res.tables...)
 		case <-time.After(10 * time.Second):
 			log.Printf("[PDF PAGE TIMEOUT] File: %s | Page: %d/%d | Skipping after 10s", filename, i, total)
 			if progress != nil {
@@ -843,28 +2498,124 @@ func ReadPDF(path, filename string, progress func(string)) (string, error) {
 		}
 	}
 
-	log.Printf("[PDF READING COMPLETE] File: %s | Pages processed: %d | Text length: %d chars",
-		filename, total, buf.Len())
-	return buf.String(), nil
+	var vocab map[string]bool
+	if opts.Dehyphenate {
+		var all strings.Builder
+		for _, text := range pages {
+			if text != nil {
+				all.WriteString(*text)
+				all.WriteString("\n")
+			}
+		}
+		vocab = hyphenVocabulary(all.String())
+	}
+
+	var buf bytes.Buffer
+	pageStarts := make([]int, 0, total)
+	words := 0
+	for _, text := range pages {
+		pageStarts = append(pageStarts, words)
+		if text == nil {
+			continue
+		}
+		if opts.Dehyphenate {
+			*text = dehyphenate(*text, vocab)
+		}
+		buf.WriteString(*text)
+		// Keep page boundaries from gluing the last and first words together.
+		buf.WriteString("\n")
+		words += len(strings.Fields(*text))
+	}
+
+	log.Printf("[PDF READING COMPLETE] File: %s | Pages processed: %d | Text length: %d chars | Tables: %d",
+		filename, total, buf.Len(), len(tables))
+	return &PDFText{
+		Text:           buf.String(),
+		Title:          pdfTitle(r),
+		Author:         pdfInfo(r, "Author"),
+		Created:        pdfCreated(r),
+		PageWordStarts: pageStarts,
+		Tables:         tables,
+	}, nil
 }
 
-// ChunkText splits the text into chunks of `size` words with a `stride`.
-func ChunkText(text string, size int, stride int) []string {
-	var chunks []string
-	words := strings.Fields(text)
+// textChunk is a run of words along with its [StartWord, EndWord) span in the source text.
+type textChunk struct {
+	Text      string
+	StartWord int
+	EndWord   int
+}
+
+// filterShortChunks removes chunks with fewer than minWords words. In merge mode
+// a short chunk is folded into the preceding chunk by extending its span, so no
+// text is lost; a short first chunk has nothing to merge into and is kept.
+func filterShortChunks(words []string, chunks []textChunk, minWords int, merge bool) ([]textChunk, int) {
+	kept := make([]textChunk, 0, len(chunks))
+	removed := 0
+	for _, chunk := range chunks {
+		if chunk.EndWord-chunk.StartWord >= minWords {
+			kept = append(kept, chunk)
+			continue
+		}
+		if merge {
+			if len(kept) == 0 {
+				kept = append(kept, chunk)
+				continue
+			}
+			prev := &kept[len(kept)-1]
+			if chunk.EndWord > prev.EndWord {
+				prev.EndWord = chunk.EndWord
+				prev.Text = strings.Join(words[prev.StartWord:prev.EndWord], " ")
+			}
+		}
+		removed++
+	}
+	return kept, removed
+}
+
+// chunkWords splits words into chunks of `size` words, starting a new chunk every `stride` words.
+//
+// Every word lands in at least one chunk: consecutive chunks share exactly
+// size-stride words, and the final chunk always ends at the last word (it may
+// be shorter than size). A stride larger than size would leave gaps between
+// chunks, so it is clamped to size; non-positive values are clamped to 1.
+func chunkWords(words []string, size int, stride int) []textChunk {
+	var chunks []textChunk
 	if len(words) == 0 {
 		return nil
 	}
+	if size < 1 {
+		size = 1
+	}
+	if stride < 1 {
+		stride = 1
+	}
+	if stride > size {
+		stride = size
+	}
 
 	for i := 0; i < len(words); i += stride {
 		end := i + size
 		if end > len(words) {
 			end = len(words)
 		}
-		chunks = append(chunks, strings.Join(words[i:end], " "))
+		chunks = append(chunks, textChunk{
+			Text:      strings.Join(words[i:end], " "),
+			StartWord: i,
+			EndWord:   end,
+		})
 		if end == len(words) {
 			break
 		}
 	}
 	return chunks
 }
+
+// ChunkText splits the text into chunks of `size` words with a `stride`.
+func ChunkText(text string, size int, stride int) []string {
+	var chunks []string
+	for _, c := range chunkWords(strings.Fields(text), size, stride) {
+		chunks = append(chunks, c.Text)
+	}
+	return chunks
+}
@@ -0,0 +1,275 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func numberedWords(n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	return words
+}
+
+func TestChunkWords(t *testing.T) {
+	tests := []struct {
+		name       string
+		words      int
+		size       int
+		stride     int
+		wantStride int // effective stride after clamping
+		wantStarts []int
+	}{
+		{name: "size equals stride", words: 10, size: 5, stride: 5, wantStride: 5, wantStarts: []int{0, 5}},
+		{name: "overlapping windows", words: 10, size: 4, stride: 3, wantStride: 3, wantStarts: []int{0, 3, 6}},
+		{name: "stride larger than size is clamped", words: 10, size: 3, stride: 7, wantStride: 3, wantStarts: []int{0, 3, 6, 9}},
+		{name: "zero stride becomes one", words: 4, size: 2, stride: 0, wantStride: 1, wantStarts: []int{0, 1, 2}},
+		{name: "negative stride becomes one", words: 4, size: 2, stride: -3, wantStride: 1, wantStarts: []int{0, 1, 2}},
+		{name: "fewer words than size", words: 3, size: 10, stride: 8, wantStride: 8, wantStarts: []int{0}},
+		{name: "last window is partial", words: 11, size: 5, stride: 5, wantStride: 5, wantStarts: []int{0, 5, 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			words := numberedWords(tt.words)
+			chunks := chunkWords(words, tt.size, tt.stride)
+
+			if len(chunks) != len(tt.wantStarts) {
+				t.Fatalf("got %d chunks, want %d: %+v", len(chunks), len(tt.wantStarts), chunks)
+			}
+			for i, c := range chunks {
+				if c.StartWord != tt.wantStarts[i] {
+					t.Errorf("chunk %d starts at word %d, want %d", i, c.StartWord, tt.wantStarts[i])
+				}
+				wantEnd := min(c.StartWord+tt.size, tt.words)
+				if c.EndWord != wantEnd {
+					t.Errorf("chunk %d ends at word %d, want %d", i, c.EndWord, wantEnd)
+				}
+				if want := strings.Join(words[c.StartWord:c.EndWord], " "); c.Text != want {
+					t.Errorf("chunk %d text = %q, want %q", i, c.Text, want)
+				}
+			}
+
+			// The last window reaches the final word.
+			if last := chunks[len(chunks)-1]; last.EndWord != tt.words {
+				t.Errorf("last chunk ends at word %d, want %d", last.EndWord, tt.words)
+			}
+
+			// Nothing is skipped between windows, and words are repeated only
+			// in the size-stride overlap of consecutive windows.
+			seen := make([]int, tt.words)
+			for i, c := range chunks {
+				for w := c.StartWord; w < c.EndWord; w++ {
+					seen[w]++
+				}
+				if i == 0 {
+					continue
+				}
+				prev := chunks[i-1]
+				if c.StartWord > prev.EndWord {
+					t.Errorf("words %d-%d fall between chunks %d and %d", prev.EndWord, c.StartWord-1, i-1, i)
+				}
+				if overlap := prev.EndWord - c.StartWord; overlap > tt.size-tt.wantStride {
+					t.Errorf("chunks %d and %d overlap by %d words, want at most %d", i-1, i, overlap, tt.size-tt.wantStride)
+				}
+			}
+			for w, n := range seen {
+				if n == 0 {
+					t.Errorf("word %d is in no chunk", w)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkWordsEmpty(t *testing.T) {
+	if chunks := chunkWords(nil, 5, 5); chunks != nil {
+		t.Errorf("chunkWords(nil) = %+v, want nil", chunks)
+	}
+}
+
+func TestToSearchResultsRagged(t *testing.T) {
+	score := func(d float32) float32 { return 1 - d }
+	ragged := &ChromaQueryResponse{
+		Ids:        [][]string{{"a", "b", "c"}},
+		Documents:  [][]string{{"doc a"}},
+		Metadatas:  [][]interface{}{{map[string]interface{}{"filename": "a.txt"}, "not a map"}},
+		Distances:  [][]float32{{0.25, 0.5}},
+		Embeddings: [][][]float32{{}},
+	}
+	tests := []struct {
+		name    string
+		res     *ChromaQueryResponse
+		q       int
+		wantIDs []string
+	}{
+		{name: "nil response", res: nil, wantIDs: []string{}},
+		{name: "empty response", res: &ChromaQueryResponse{}, wantIDs: []string{}},
+		{name: "query beyond outer arrays", res: &ChromaQueryResponse{Ids: [][]string{{"a"}}}, q: 1, wantIDs: []string{}},
+		{name: "negative query", res: &ChromaQueryResponse{Ids: [][]string{{"a"}}}, q: -1, wantIDs: []string{}},
+		{name: "ids only", res: &ChromaQueryResponse{Ids: [][]string{{"a", "b"}}}, wantIDs: []string{"a", "b"}},
+		{name: "short inner arrays", res: ragged, wantIDs: []string{"a", "b", "c"}},
+		{
+			name: "second query missing from other arrays",
+			res: &ChromaQueryResponse{
+				Ids:       [][]string{{"a"}, {"x"}},
+				Documents: [][]string{{"doc a"}},
+				Distances: [][]float32{{0.25}},
+			},
+			q:       1,
+			wantIDs: []string{"x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := toSearchResults(tt.res, tt.q, "docs", score)
+			if results == nil {
+				t.Fatal("toSearchResults returned nil, want an empty list")
+			}
+			if len(results) != len(tt.wantIDs) {
+				t.Fatalf("got %d results, want %d: %+v", len(results), len(tt.wantIDs), results)
+			}
+			for i, r := range results {
+				if r.ID != tt.wantIDs[i] {
+					t.Errorf("result %d id = %q, want %q", i, r.ID, tt.wantIDs[i])
+				}
+				if r.Collection != "docs" {
+					t.Errorf("result %d collection = %q, want docs", i, r.Collection)
+				}
+			}
+		})
+	}
+
+	// Fields present for a hit are still filled in when later hits lack them.
+	results := toSearchResults(ragged, 0, "docs", score)
+	if results[0].Document != "doc a" || results[0].Metadata["filename"] != "a.txt" || results[0].Distance != 0.25 || results[0].Score != 0.75 {
+		t.Errorf("first result = %+v, want its document, metadata and distance", results[0])
+	}
+	if results[1].Document != "" || results[1].Metadata != nil || results[1].Distance != 0.5 {
+		t.Errorf("second result = %+v, want only its distance", results[1])
+	}
+	if results[2].Document != "" || results[2].Metadata != nil || results[2].Distance != 0 || results[2].Embedding != nil {
+		t.Errorf("third result = %+v, want only its id", results[2])
+	}
+}
+
+func TestRetryBudgetExhausted(t *testing.T) {
+	retries := &uploadRetries{perCall: 3, remaining: 2, budget: 2}
+	calls := 0
+	err := retries.do(context.Background(), "embed", func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	if calls != 3 {
+		t.Errorf("fn called %d times, want 3 (one try plus the budget of 2)", calls)
+	}
+	if !budgetExhausted(err) {
+		t.Fatalf("budgetExhausted(%v) = false, want true", err)
+	}
+	var ue *uploadError
+	if !errors.As(err, &ue) || ue.status != http.StatusServiceUnavailable {
+		t.Errorf("err = %#v, want an uploadError with status 503", err)
+	}
+
+	// Other 503s, and failures that merely use up their per-call retries, don't count.
+	other := &uploadError{status: http.StatusServiceUnavailable, msg: "generation model not configured"}
+	if budgetExhausted(other) {
+		t.Error("an unrelated 503 uploadError counts as an exhausted budget")
+	}
+	retries = &uploadRetries{perCall: 1, remaining: 10, budget: 10}
+	err = retries.do(context.Background(), "embed", func() error { return errors.New("boom") })
+	if err == nil || budgetExhausted(err) {
+		t.Errorf("err = %v after per-call retries, want the last fn error", err)
+	}
+}
+
+func TestDehyphenate(t *testing.T) {
+	vocab := hyphenVocabulary("An example of a cooperative effort. Über alles.")
+	tests := []struct {
+		name, in, want string
+	}{
+		{name: "word seen elsewhere", in: "an exam-\nple here", want: "an example here"},
+		{name: "leading punctuation", in: "(exam-\nple)", want: "(example)"},
+		{name: "case-insensitive lookup", in: "Exam-\nple", want: "Example"},
+		{name: "non-ASCII", in: "Üb-\ner", want: "Über"},
+		{name: "compound kept", in: "long-\nterm", want: "long-term"},
+		{name: "compound kept with spaces", in: "well- \n  known", want: "well-known"},
+		{name: "self-service kept", in: "self-\nservice", want: "self-service"},
+		{name: "digit after break", in: "COVID-\n19", want: "COVID-19"},
+		{name: "capital after break", in: "Franco-\nPrussian", want: "Franco-Prussian"},
+		{name: "word already hyphenated", in: "co-oper-\native", want: "co-oper-ative"},
+		{name: "state of the art", in: "state-of-\nthe-art", want: "state-of-the-art"},
+		{name: "soft hyphen in broken word", in: "co­op-\nerative", want: "cooperative"},
+		{name: "soft hyphen at line end", in: "coop­\nerative", want: "cooperative"},
+		{name: "no line break", in: "long-term", want: "long-term"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dehyphenate(tt.in, vocab); got != tt.want {
+				t.Errorf("dehyphenate(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoostApply(t *testing.T) {
+	linear, _ := newScoreFunc(scoreLinear, 1, 0)
+	rerankScore := func(v float64) *float64 { return &v }
+	boost := searchBoost{rules: []boostRule{{key: "tags", value: "urgent", factor: 2}}}
+	urgent := map[string]interface{}{"tags": "urgent"}
+	tests := []struct {
+		name    string
+		results []SearchResult
+		want    []string
+	}{
+		{
+			// Both scores are negative under linear scoring; the boost must
+			// still lift the urgent hit rather than push it down.
+			name: "negative linear scores",
+			results: []SearchResult{
+				{ID: "plain", Distance: 1.2, Score: linear(1.2)},
+				{ID: "urgent", Distance: 1.5, Score: linear(1.5), Metadata: urgent},
+			},
+			want: []string{"urgent", "plain"},
+		},
+		{
+			name: "boost refines rerank order",
+			results: []SearchResult{
+				{ID: "plain", Distance: 0.1, RerankScore: rerankScore(0.8)},
+				{ID: "urgent", Distance: 0.9, RerankScore: rerankScore(0.5), Metadata: urgent},
+			},
+			want: []string{"urgent", "plain"},
+		},
+		{
+			name: "factor too small to overtake",
+			results: []SearchResult{
+				{ID: "plain", Distance: 0.1, RerankScore: rerankScore(0.9)},
+				{ID: "urgent", Distance: 0.9, RerankScore: rerankScore(0.3), Metadata: urgent},
+			},
+			want: []string{"plain", "urgent"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boost.apply(tt.results)
+			var got []string
+			for _, res := range tt.results {
+				got = append(got, res.ID)
+				if res.BoostedScore == nil || *res.BoostedScore < 0 {
+					t.Errorf("%s: boosted score %v, want non-negative", res.ID, res.BoostedScore)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
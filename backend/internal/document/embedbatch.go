@@ -0,0 +1,59 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseBatchSizes reads EMBED_BATCH_SIZES, a comma-separated list of
+// model=size pairs such as "mxbai-embed-large=8,nomic-embed-text=64", or
+// the same as a JSON object (how a CONFIG_FILE object arrives).
+func parseBatchSizes(spec string) (map[string]int, error) {
+	sizes := make(map[string]int)
+	if strings.HasPrefix(strings.TrimSpace(spec), "{") {
+		if err := json.Unmarshal([]byte(spec), &sizes); err != nil {
+			return nil, fmt.Errorf("invalid JSON object: %w", err)
+		}
+		for model, n := range sizes {
+			if n <= 0 {
+				return nil, fmt.Errorf("batch size for %s must be a positive integer, got %d", model, n)
+			}
+		}
+		return sizes, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		model, size, ok := strings.Cut(pair, "=")
+		model = strings.TrimSpace(model)
+		if !ok || model == "" {
+			return nil, fmt.Errorf("expected model=size, got %q", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("batch size for %s must be a positive integer, got %q", model, size)
+		}
+		sizes[model] = n
+	}
+	return sizes, nil
+}
+
+// embedBatchSize is how many texts are sent per embedding call for model:
+// its EMBED_BATCH_SIZES entry (matching with or without a ":latest" tag),
+// else EMBED_BATCH_SIZE.
+func (h *Handler) embedBatchSize(model string) int {
+	if n, ok := h.config.EmbedBatchSizes[model]; ok {
+		return n
+	}
+	if n, ok := h.config.EmbedBatchSizes[strings.TrimSuffix(model, ":latest")]; ok {
+		return n
+	}
+	if n, ok := h.config.EmbedBatchSizes[model+":latest"]; ok {
+		return n
+	}
+	return h.config.EmbedBatchSize
+}
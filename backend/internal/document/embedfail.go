@@ -0,0 +1,56 @@
+package document
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// EMBED_FAILURE_POLICY values.
+const (
+	embedFailSkip      = "skip"
+	embedFailAbort     = "fail"
+	embedFailThreshold = "fail-threshold"
+)
+
+// checkEmbedFailures applies EMBED_FAILURE_POLICY after a chunk failed to
+// embed, with failed of the upload's total chunks failed so far. It returns
+// the error to abort the upload with, or nil to skip the chunk and go on.
+// Chunks already stored are kept either way.
+func (h *Handler) checkEmbedFailures(failed, total int, cause error) error {
+	switch h.config.EmbedFailurePolicy {
+	case embedFailAbort:
+		return &uploadError{
+			status: http.StatusBadGateway,
+			msg:    fmt.Sprintf("embedding failed, upload aborted (EMBED_FAILURE_POLICY=%s): %v", embedFailAbort, cause),
+		}
+	case embedFailThreshold:
+		if float64(failed)*100 > h.config.EmbedFailureThreshold*float64(total) {
+			return &uploadError{
+				status: http.StatusBadGateway,
+				msg: fmt.Sprintf("%d of %d chunks failed to embed, over the %g%% limit; upload aborted: %v",
+					failed, total, h.config.EmbedFailureThreshold, cause),
+			}
+		}
+	}
+	return nil
+}
+
+// maxReportedFailures caps IngestResult.Failures so a document whose every
+// chunk fails doesn't produce an enormous response.
+const maxReportedFailures = 100
+
+// ChunkFailure records why one chunk of an upload was not stored.
+type ChunkFailure struct {
+	Chunk int    `json:"chunk"`
+	Error string `json:"error"`
+}
+
+// addFailure records that chunk failed at stage ("embedding" or "storage").
+// Past maxReportedFailures only FailuresTruncated is set.
+func (r *IngestResult) addFailure(chunk int, stage string, err error) {
+	if len(r.Failures) >= maxReportedFailures {
+		r.FailuresTruncated = true
+		return
+	}
+	r.Failures = append(r.Failures, ChunkFailure{Chunk: chunk, Error: stage + ": " + err.Error()})
+}
@@ -0,0 +1,137 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// exportPageSize is how many records are fetched from Chroma per get call.
+const exportPageSize = 500
+
+// fullRecord asks Chroma's get endpoint for everything stored with a record.
+var fullRecord = []string{"documents", "metadatas", "embeddings"}
+
+// ExportRecord is one line of the JSONL produced by /api/export and read by /api/import.
+type ExportRecord struct {
+	ID        string                 `json:"id"`
+	Document  string                 `json:"document"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	Embedding []float32              `json:"embedding"`
+}
+
+// ChromaGetRecordsResponse is the body of a collection get with documents, metadatas and embeddings.
+type ChromaGetRecordsResponse struct {
+	Ids        []string                 `json:"ids"`
+	Documents  []string                 `json:"documents"`
+	Metadatas  []map[string]interface{} `json:"metadatas"`
+	Embeddings [][]float32              `json:"embeddings"`
+}
+
+// HandleExport streams every record in the collection as JSONL, one page of
+// Chroma results at a time so large collections are never held in memory.
+func (h *Handler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	colID, err := h.collectionID(h.config.Collection)
+	if err != nil {
+		http.Error(w, err.Error(), collectionErrorStatus(err))
+		return
+	}
+
+	// Headers are only committed with the first page, so Chroma errors before
+	// then still get a proper status.
+	var enc *json.Encoder
+	flusher, _ := w.(http.Flusher)
+	exported := 0
+	err = h.iterateCollection(colID, exportPageSize, fullRecord, func(page *ChromaGetRecordsResponse) error {
+		if enc == nil {
+			// Large exports outlive the server write timeout.
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+				log.Printf("[EXPORT WARNING] Could not clear write deadline: %v", err)
+			}
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", h.config.Collection+".jsonl"))
+			enc = json.NewEncoder(w)
+		}
+
+		for i, id := range page.Ids {
+			rec := ExportRecord{ID: id}
+			if i < len(page.Documents) {
+				rec.Document = page.Documents[i]
+			}
+			if i < len(page.Metadatas) {
+				rec.Metadata = page.Metadatas[i]
+			}
+			if i < len(page.Embeddings) {
+				rec.Embedding = page.Embeddings[i]
+			}
+			if err := enc.Encode(rec); err != nil {
+				return fmt.Errorf("client write failed after %d records: %w", exported, err)
+			}
+			exported++
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if r.Context().Err() != nil {
+			return errStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[EXPORT ERROR] %v", err)
+		if enc == nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		// Otherwise headers are already sent; the truncated stream is the only signal left.
+		return
+	}
+	if enc == nil {
+		// An empty collection still produces a valid, empty JSONL download.
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", h.config.Collection+".jsonl"))
+	}
+
+	log.Printf("[EXPORT COMPLETE] Collection: %s | Records: %d", h.config.Collection, exported)
+}
+
+// getRecords fetches one page of records from a collection with the given
+// fields ("documents", "metadatas", "embeddings") included.
+func (h *Handler) getRecords(colID string, offset, limit int, include []string) (*ChromaGetRecordsResponse, error) {
+	return h.chromaGet(colID, map[string]interface{}{
+		"limit":   limit,
+		"offset":  offset,
+		"include": include,
+	})
+}
+
+// chromaGet posts a get request body to a collection and decodes the records.
+func (h *Handler) chromaGet(colID string, body map[string]interface{}) (*ChromaGetRecordsResponse, error) {
+	getURL := fmt.Sprintf("%s%s/%s/get", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
+	reqBody, _ := json.Marshal(body)
+
+	resp, err := h.storeClient.Post(getURL, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to POST to %s: %w", getURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("chroma get returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var page ChromaGetRecordsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode chroma get response: %w", err)
+	}
+	return &page, nil
+}
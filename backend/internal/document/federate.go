@@ -0,0 +1,107 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/akhilmk/gowise/internal/auth"
+)
+
+// listCollectionsPage is how many collections are listed per Chroma call.
+const listCollectionsPage = 100
+
+// listCollections returns the API-facing names of every collection in the
+// namespace, sorted.
+func (h *Handler) listCollections() ([]string, error) {
+	prefix := h.config.chromaName("")
+	var names []string
+	for offset := 0; ; offset += listCollectionsPage {
+		listURL := fmt.Sprintf("%s%s?limit=%d&offset=%d", h.config.ChromaURL, h.config.ChromaAPIBase, listCollectionsPage, offset)
+		resp, err := h.storeClient.Get(listURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to GET %s: %w", listURL, err)
+		}
+		var page []ChromaGetResponse
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("list collections returned status %d: %s", resp.StatusCode, string(body))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode collection list: %w", err)
+		}
+
+		for _, c := range page {
+			if name, ok := strings.CutPrefix(c.Name, prefix); ok && name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(page) < listCollectionsPage {
+			break
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// searchesAllCollections reports whether a search without a collection
+// parameter should cover every collection: ADMIN_SEARCH_ALL_COLLECTIONS is
+// on and the caller is an admin.
+func (h *Handler) searchesAllCollections(r *http.Request) bool {
+	if !h.config.AdminSearchAllCollections || r.URL.Query().Get("collection") != "" {
+		return false
+	}
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	return ok && claims.HasRole(auth.RoleAdmin)
+}
+
+// searchAllCollections runs the query against every collection and merges
+// the hits by distance, keeping the nResults closest. A collection that
+// fails is logged and skipped; the search only fails if all of them do, or
+// ctx ends first.
+func (h *Handler) searchAllCollections(ctx context.Context, embedding []float32, nResults int, withEmbeddings bool, where map[string]interface{}) ([]SearchResult, error) {
+	collections, err := h.listCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	var firstErr error
+	failed := 0
+	for _, collection := range collections {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		res, err := h.queryChroma(ctx, collection, embedding, nResults, withEmbeddings, where)
+		if err != nil {
+			if !errors.Is(err, ErrCollectionNotFound) {
+				log.Printf("[SEARCH WARNING] Skipping collection %s: %v", collection, err)
+				failed++
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+			continue
+		}
+		results = append(results, toSearchResults(res, 0, collection, h.score)...)
+	}
+	if failed > 0 && failed == len(collections) {
+		return nil, firstErr
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Distance < results[j].Distance })
+	if len(results) > nResults {
+		results = results[:nResults]
+	}
+	log.Printf("[SEARCH] Searched %d collections (%d failed), %d hits", len(collections), failed, len(results))
+	return results, nil
+}
@@ -0,0 +1,96 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetChars is the length of the document excerpt returned for the "snippet" field.
+const snippetChars = 200
+
+// projectableFields are the per-result fields a client can select with ?fields=.
+var projectableFields = map[string]bool{
+	"id":         true,
+	"score":      true,
+	"distance":   true,
+	"snippet":    true,
+	"document":   true,
+	"metadata":   true,
+	"page":       true,
+	"collection": true,
+}
+
+// ProjectedSearchResponse is returned by HandleSearch when ?fields= narrows the results.
+type ProjectedSearchResponse struct {
+	Query       string                   `json:"query"`
+	Results     []map[string]interface{} `json:"results"`
+	Reranked    bool                     `json:"reranked"`
+	Diversified bool                     `json:"diversified"`
+}
+
+// parseFields validates a comma-separated field list. An empty spec means
+// "everything" and returns nil.
+func parseFields(spec string) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !projectableFields[f] {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// projectResult copies only the requested fields of a result into a map.
+func projectResult(r SearchResult, fields []string) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		switch f {
+		case "id":
+			out["id"] = r.ID
+		case "score":
+			out["score"] = r.Score
+			if r.RerankScore != nil {
+				out["rerank_score"] = *r.RerankScore
+			}
+			if r.BoostedScore != nil {
+				out["boosted_score"] = *r.BoostedScore
+			}
+		case "distance":
+			out["distance"] = r.Distance
+		case "snippet":
+			out["snippet"] = snippet(r.Document, snippetChars)
+		case "document":
+			out["document"] = r.Document
+		case "metadata":
+			out["metadata"] = r.Metadata
+		case "page":
+			out["page"] = metadataInt(r.Metadata, "page")
+		case "collection":
+			out["collection"] = r.Collection
+		}
+	}
+	return out
+}
+
+// snippet shortens text to at most n characters, cutting at a word boundary
+// where possible.
+func snippet(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)[:n]
+	cut := string(runes)
+	if i := strings.LastIndexByte(cut, ' '); i > n/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
@@ -0,0 +1,51 @@
+package document
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// hashFile returns the hex SHA-256 of an upload's full contents, stored on
+// every chunk as file_hash so re-uploads of the same file can be recognized.
+func hashFile(src io.ReaderAt, size int64) (string, error) {
+	sum := sha256.New()
+	if _, err := io.Copy(sum, io.NewSectionReader(src, 0, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// ingestedFile identifies the document an identical file was stored as.
+type ingestedFile struct {
+	filename   string
+	documentID string
+}
+
+// findIngestedFile looks for a chunk in collection with the given file_hash.
+// It returns nil when there is none, including when the collection doesn't exist.
+func (h *Handler) findIngestedFile(collection, fileHash string) (*ingestedFile, error) {
+	colID, err := h.findCollection(collection)
+	if err != nil {
+		if errors.Is(err, ErrCollectionNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	page, err := h.chromaGet(colID, map[string]interface{}{
+		"where":   map[string]interface{}{"file_hash": fileHash},
+		"limit":   1,
+		"include": []string{"metadatas"},
+	})
+	if err != nil || len(page.Ids) == 0 {
+		return nil, err
+	}
+	found := &ingestedFile{}
+	if len(page.Metadatas) > 0 {
+		found.filename, _ = page.Metadatas[0]["filename"].(string)
+		found.documentID, _ = page.Metadatas[0]["document_id"].(string)
+	}
+	return found, nil
+}
@@ -0,0 +1,134 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filename collision policies (FILENAME_COLLISION).
+const (
+	// collisionKeep stores the upload under the same filename; documents stay
+	// distinguishable by their document_id.
+	collisionKeep = "keep"
+	// collisionSuffix renames the upload to "name (2).pdf", "name (3).pdf", ...
+	collisionSuffix = "suffix"
+	// collisionReject refuses the upload with 409.
+	collisionReject = "reject"
+)
+
+// maxFilenameBytes matches the common filesystem limit for one path component.
+const maxFilenameBytes = 255
+
+// maxSuffixAttempts bounds the search for a free "name (n).ext".
+const maxSuffixAttempts = 100
+
+// sanitizeFilename reduces a client-supplied filename to a safe display name:
+// directory components (either slash style) and control characters are
+// removed, whitespace is collapsed, and the name is cut to maxFilenameBytes
+// keeping its extension.
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return "upload"
+	}
+
+	if len(name) > maxFilenameBytes {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		base := name[:maxFilenameBytes-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = strings.TrimSpace(base) + ext
+	}
+	return name
+}
+
+// errFilenameTaken is returned under the reject policy when the name is in use.
+var errFilenameTaken = errors.New("a document with this filename already exists")
+
+// resolveFilename applies the collision policy to an upload's filename in
+// collection and returns the name to store it under.
+func (h *Handler) resolveFilename(collection, name string) (string, error) {
+	if h.config.FilenameCollision == collisionKeep {
+		return name, nil
+	}
+	taken, err := h.filenameExists(collection, name)
+	if err != nil || !taken {
+		return name, err
+	}
+	if h.config.FilenameCollision == collisionReject {
+		return "", fmt.Errorf("%w: %s", errFilenameTaken, name)
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 2; n <= maxSuffixAttempts; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		taken, err := h.filenameExists(collection, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for %s after %d attempts", name, maxSuffixAttempts)
+}
+
+// filenameExists reports whether any chunk in collection has the given filename.
+func (h *Handler) filenameExists(collection, name string) (bool, error) {
+	colID, err := h.findCollection(collection)
+	if err != nil {
+		if errors.Is(err, ErrCollectionNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	getURL := fmt.Sprintf("%s%s/%s/get", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"where":   map[string]interface{}{"filename": name},
+		"limit":   1,
+		"include": []string{},
+	})
+
+	resp, err := h.storeClient.Post(getURL, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return false, fmt.Errorf("failed to POST to %s: %w", getURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("chroma get returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var data struct {
+		Ids []string `json:"ids"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return false, fmt.Errorf("failed to decode chroma get response: %w", err)
+	}
+	return len(data.Ids) > 0, nil
+}
@@ -0,0 +1,89 @@
+package document
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of an upload is inspected to confirm its type.
+const sniffLen = 512
+
+// supportedExtensions are the file types extract knows how to read;
+// ALLOWED_EXTENSIONS may only narrow this list.
+var supportedExtensions = []string{".pdf", ".txt", ".md"}
+
+// parseExtensions turns a comma-separated list like "pdf, .TXT" into
+// normalized lowercase extensions with a leading dot.
+func parseExtensions(spec string) []string {
+	var exts []string
+	for _, p := range strings.Split(spec, ",") {
+		ext := strings.ToLower(strings.TrimSpace(p))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+// allowedExtension returns the lowercase extension of filename and whether
+// it is in the ALLOWED_EXTENSIONS list.
+func (h *Handler) allowedExtension(filename string) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, allowed := range h.config.AllowedExtensions {
+		if ext == allowed {
+			return ext, true
+		}
+	}
+	return ext, false
+}
+
+// contentMatchesExtension checks the leading bytes of an upload against what
+// its extension claims, so a binary renamed to .txt or .pdf is rejected.
+func contentMatchesExtension(ext string, head []byte) bool {
+	switch ext {
+	case ".pdf":
+		return bytes.HasPrefix(head, []byte("%PDF-"))
+	case ".txt", ".md":
+		// A multi-byte rune may be cut off at the end of the sniffed window.
+		for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+			head = head[:len(head)-1]
+		}
+		return utf8.Valid(head) && strings.HasPrefix(http.DetectContentType(head), "text/plain")
+	default:
+		// Validate keeps unsupported extensions out of ALLOWED_EXTENSIONS.
+		return false
+	}
+}
+
+// readHead returns up to sniffLen bytes from the start of src.
+func readHead(src io.ReaderAt) ([]byte, error) {
+	head := make([]byte, sniffLen)
+	n, err := src.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// isPlainText reports whether the extension is ingested as raw text rather than PDF.
+func isPlainText(ext string) bool {
+	return ext == ".txt" || ext == ".md"
+}
+
+// ReadText wraps a plain-text upload as a single-page document.
+func ReadText(src io.ReaderAt, size int64) (*PDFText, error) {
+	data, err := io.ReadAll(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+	return &PDFText{Text: text, Title: markdownTitle(text), PageWordStarts: []int{0}}, nil
+}
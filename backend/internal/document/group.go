@@ -0,0 +1,71 @@
+package document
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GroupedSearchResponse is returned by HandleSearch with ?groupBy=filename.
+type GroupedSearchResponse struct {
+	Query       string        `json:"query"`
+	Groups      []ResultGroup `json:"groups"`
+	TotalHits   int           `json:"total_hits"`
+	Reranked    bool          `json:"reranked"`
+	Diversified bool          `json:"diversified"`
+}
+
+// ResultGroup holds the hits from one source document. BestScore is the
+// highest rerank score when the results were reranked, the vector score
+// otherwise. Results are the group's hits in ranked order, projected to
+// ?fields= when given.
+type ResultGroup struct {
+	Filename  string        `json:"filename"`
+	BestScore float64       `json:"best_score"`
+	Snippets  []string      `json:"snippets"`
+	Results   []interface{} `json:"results"`
+}
+
+// parseGroupBy validates the groupBy parameter; "" means no grouping.
+func parseGroupBy(v string) (string, error) {
+	switch v {
+	case "", "filename":
+		return v, nil
+	}
+	return "", fmt.Errorf("unsupported groupBy %q (supported: filename)", v)
+}
+
+// groupByFilename groups ranked results by their source filename and orders
+// the groups by their best score, keeping each group's hits in rank order.
+func groupByFilename(results []SearchResult, fields []string) []ResultGroup {
+	groups := []ResultGroup{}
+	index := make(map[string]int)
+	for _, res := range results {
+		filename, _ := res.Metadata["filename"].(string)
+		score := float64(res.Score)
+		if res.BoostedScore != nil {
+			score = *res.BoostedScore
+		} else if res.RerankScore != nil {
+			score = *res.RerankScore
+		}
+
+		i, ok := index[filename]
+		if !ok {
+			i = len(groups)
+			index[filename] = i
+			groups = append(groups, ResultGroup{Filename: filename, BestScore: score})
+		}
+		g := &groups[i]
+		if score > g.BestScore {
+			g.BestScore = score
+		}
+		g.Snippets = append(g.Snippets, snippet(res.Document, snippetChars))
+		if fields != nil {
+			g.Results = append(g.Results, projectResult(res, fields))
+		} else {
+			g.Results = append(g.Results, res)
+		}
+	}
+
+	sort.SliceStable(groups, func(a, b int) bool { return groups[a].BestScore > groups[b].BestScore })
+	return groups
+}
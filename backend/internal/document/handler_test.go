@@ -0,0 +1,1101 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testModel = "test-embed"
+
+// fakeBackend serves the Ollama and Chroma endpoints the handler calls,
+// keeping added records in memory.
+type fakeBackend struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	records map[string][]fakeRecord // by collection ID
+	calls   map[string]int          // collection requests by operation
+	// query, when set, replaces the default query response.
+	query func(n int) any
+	// queryStatus, when set, fails every query with that status.
+	queryStatus int
+	// delay slows down embedding, generation and record reads.
+	delay time.Duration
+	// embedded records every text sent to be embedded.
+	embedded []string
+	// embedBatches records the number of inputs of every batch embedding request.
+	embedBatches []int
+	// onEmbed, when set, runs on every embedding request.
+	onEmbed func()
+}
+
+type fakeRecord struct {
+	id       string
+	document string
+	metadata map[string]any
+}
+
+func newFakeBackend(t *testing.T) *fakeBackend {
+	t.Helper()
+	f := &fakeBackend{records: make(map[string][]fakeRecord), calls: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeBackend) serve(w http.ResponseWriter, r *http.Request) {
+	const base = "/api/v2/tenants/default_tenant/databases/default_database/collections"
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.URL.Path == "/api/tags":
+		json.NewEncoder(w).Encode(map[string]any{"models": []map[string]string{{"name": testModel}}})
+	case r.URL.Path == "/api/v2/heartbeat":
+		json.NewEncoder(w).Encode(map[string]int64{"nanosecond heartbeat": time.Now().UnixNano()})
+	case r.URL.Path == "/api/ps":
+		json.NewEncoder(w).Encode(map[string]any{"models": []any{}})
+	case r.URL.Path == "/api/embeddings":
+		var req EmbeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.embedded = append(f.embedded, req.Prompt)
+		f.mu.Unlock()
+		if f.onEmbed != nil {
+			f.onEmbed()
+		}
+		time.Sleep(f.delay)
+		json.NewEncoder(w).Encode(map[string]any{"embedding": []float32{0.1, 0.2, 0.3}})
+	case r.URL.Path == "/api/embed":
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.embedded = append(f.embedded, req.Input...)
+		f.embedBatches = append(f.embedBatches, len(req.Input))
+		f.mu.Unlock()
+		if f.onEmbed != nil {
+			f.onEmbed()
+		}
+		time.Sleep(f.delay)
+		embeddings := make([][]float32, len(req.Input))
+		for i := range embeddings {
+			embeddings[i] = []float32{0.1, 0.2, 0.3}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": embeddings})
+	case r.URL.Path == "/api/generate":
+		time.Sleep(f.delay)
+		json.NewEncoder(w).Encode(GenerateResponse{Response: "An answer [1].", Done: true})
+	case r.URL.Path == base && r.Method == http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]string{"id": "id-" + req.Name})
+	case strings.HasPrefix(r.URL.Path, base+"/"):
+		f.serveCollection(w, r, strings.TrimPrefix(r.URL.Path, base+"/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeBackend) serveCollection(w http.ResponseWriter, r *http.Request, rest string) {
+	colID, op, _ := strings.Cut(rest, "/")
+	if op == "get" {
+		time.Sleep(f.delay)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[op]++
+
+	switch op {
+	case "":
+		json.NewEncoder(w).Encode(map[string]string{"id": "id-" + colID})
+	case "count":
+		json.NewEncoder(w).Encode(len(f.records[colID]))
+	case "add", "upsert":
+		var req struct {
+			Ids       []string         `json:"ids"`
+			Documents []string         `json:"documents"`
+			Metadatas []map[string]any `json:"metadatas"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		for i, id := range req.Ids {
+			rec := fakeRecord{id: id}
+			if i < len(req.Documents) {
+				rec.document = req.Documents[i]
+			}
+			if i < len(req.Metadatas) {
+				rec.metadata = req.Metadatas[i]
+			}
+			f.records[colID] = append(f.records[colID], rec)
+		}
+		w.Write([]byte("true"))
+	case "get":
+		var req struct {
+			Where  map[string]any `json:"where"`
+			Limit  int            `json:"limit"`
+			Offset int            `json:"offset"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var records []fakeRecord
+		for _, rec := range f.records[colID] {
+			if matchesWhere(rec.metadata, req.Where) {
+				records = append(records, rec)
+			}
+		}
+		if req.Offset < len(records) {
+			records = records[req.Offset:]
+		} else {
+			records = nil
+		}
+		if req.Limit > 0 && req.Limit < len(records) {
+			records = records[:req.Limit]
+		}
+		res := ChromaGetRecordsResponse{Ids: []string{}, Documents: []string{}, Metadatas: []map[string]any{}}
+		for _, rec := range records {
+			res.Ids = append(res.Ids, rec.id)
+			res.Documents = append(res.Documents, rec.document)
+			res.Metadatas = append(res.Metadatas, rec.metadata)
+		}
+		json.NewEncoder(w).Encode(res)
+	case "query":
+		var req struct {
+			QueryEmbeddings [][]float32 `json:"query_embeddings"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if f.queryStatus != 0 {
+			http.Error(w, "query failed", f.queryStatus)
+			return
+		}
+		if f.query != nil {
+			json.NewEncoder(w).Encode(f.query(len(req.QueryEmbeddings)))
+			return
+		}
+		res := &ChromaQueryResponse{}
+		padQueryResponse(res, len(req.QueryEmbeddings))
+		for q := range req.QueryEmbeddings {
+			for _, rec := range f.records[colID] {
+				res.Ids[q] = append(res.Ids[q], rec.id)
+				res.Documents[q] = append(res.Documents[q], rec.document)
+				res.Metadatas[q] = append(res.Metadatas[q], rec.metadata)
+				res.Distances[q] = append(res.Distances[q], 0.5)
+			}
+		}
+		json.NewEncoder(w).Encode(res)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// matchesWhere reports whether meta has every field of a where clause made of
+// plain equality conditions; operators such as $and aren't supported.
+func matchesWhere(meta, where map[string]any) bool {
+	for k, v := range where {
+		if meta[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// queriesEmbedded returns the texts embedded other than dimension probes.
+func (f *fakeBackend) queriesEmbedded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var texts []string
+	for _, text := range f.embedded {
+		if text != dimensionProbe {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// newTestHandler builds a Handler from the environment, pointed at backend.
+func newTestHandler(t *testing.T, backend *fakeBackend, env map[string]string) *Handler {
+	t.Helper()
+	t.Setenv("OLLAMA_URL", backend.URL)
+	t.Setenv("CHROMA_URL", backend.URL)
+	t.Setenv("EMBEDDING_MODELS", testModel)
+	t.Setenv("UPLOAD_TEMP_DIR", t.TempDir())
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	return NewHandler(cfg)
+}
+
+func passThrough(next http.HandlerFunc) http.HandlerFunc { return next }
+
+// TestHandlerConcurrentRequests drives searches, ingests and reads in
+// parallel against one Handler so `go test -race` sees its shared clients,
+// caches, semaphores and quota counters used concurrently.
+func TestHandlerConcurrentRequests(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, map[string]string{
+		"STALE_CACHE_SIZE":       "8",
+		"MAX_CONCURRENT_UPLOADS": "2",
+		"OLLAMA_MAX_CONCURRENCY": "2",
+		"QUOTA_IP_SEARCHES":      "100000",
+		"QUOTA_IP_UPLOADS":       "100000",
+	})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, passThrough, passThrough)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	const workers = 8
+	const rounds = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*rounds*5)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				body := fmt.Sprintf(`{"text":"worker %d round %d writes about concurrent handlers","filename":"doc-%d-%d.txt"}`, w, i, w, i)
+				resp, err := http.Post(srv.URL+"/api/ingest", "application/json", strings.NewReader(body))
+				errs <- checkStatus("ingest", resp, err, http.StatusOK, http.StatusServiceUnavailable)
+
+				for _, path := range []string{
+					"/api/search?q=" + url.QueryEscape("concurrent handlers"),
+					"/api/suggest?q=conc",
+					"/api/stats",
+					"/api/corpus/stats",
+				} {
+					resp, err := http.Get(srv.URL + path)
+					errs <- checkStatus(path, resp, err, http.StatusOK)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// checkStatus reports an error unless resp has one of the wanted statuses.
+func checkStatus(name string, resp *http.Response, err error, want ...int) error {
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, status := range want {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: status %d: %s", name, resp.StatusCode, body)
+}
+
+func TestSearchEmptyCollection(t *testing.T) {
+	tests := []struct {
+		name  string
+		query func(n int) any
+	}{
+		{name: "no records", query: nil},
+		{name: "missing arrays", query: func(int) any { return map[string]any{} }},
+		{name: "empty outer arrays", query: func(int) any {
+			return map[string]any{"ids": [][]string{}, "documents": [][]string{}, "metadatas": [][]any{}, "distances": [][]float32{}}
+		}},
+		{name: "null inner arrays", query: func(int) any {
+			return map[string]any{"ids": []any{nil}, "documents": []any{nil}, "metadatas": []any{nil}, "distances": []any{nil}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeBackend(t)
+			backend.query = tt.query
+			h := newTestHandler(t, backend, nil)
+
+			rec := httptest.NewRecorder()
+			h.HandleSearch(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=anything", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				Results []SearchResult `json:"results"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Results == nil || len(resp.Results) != 0 {
+				t.Errorf("results = %#v, want empty list", resp.Results)
+			}
+
+			rec = httptest.NewRecorder()
+			h.HandleSearch(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=anything&raw=true", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("raw: status %d: %s", rec.Code, rec.Body)
+			}
+			var raw ChromaQueryResponse
+			if err := json.NewDecoder(rec.Body).Decode(&raw); err != nil {
+				t.Fatal(err)
+			}
+			if len(raw.Ids) != 1 || raw.Ids[0] == nil || len(raw.Ids[0]) != 0 {
+				t.Errorf("raw ids = %#v, want one empty list", raw.Ids)
+			}
+
+			backend.mu.Lock()
+			defer backend.mu.Unlock()
+			if n := backend.calls["count"]; n != 0 {
+				t.Errorf("search made %d count requests, want 0", n)
+			}
+			if n := backend.calls["query"]; n != 2 {
+				t.Errorf("search made %d query requests, want 2", n)
+			}
+		})
+	}
+}
+
+func TestJSONHandlersRejectUnknownFields(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, map[string]string{"GENERATION_MODEL": "test-chat"})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, passThrough, passThrough)
+
+	for _, path := range []string{"/api/ingest", "/api/search/batch", "/api/ask", "/api/delete", "/api/ingest/url", "/api/collections/rename", "/api/embed", "/api/compare"} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"txet":"typo"}`)))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), `unknown field "txet"`) {
+				t.Errorf("body %q doesn't name the unknown field", rec.Body)
+			}
+		})
+	}
+}
+
+// newShortWriteTimeoutServer serves mux with a write timeout shorter than the
+// backend delay, as a production server's WRITE_TIMEOUT would be for slow work.
+func newShortWriteTimeoutServer(t *testing.T, mux http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestIngestOutlivesWriteTimeout(t *testing.T) {
+	backend := newFakeBackend(t)
+	backend.delay = 200 * time.Millisecond
+	h := newTestHandler(t, backend, nil)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, passThrough, passThrough)
+	srv := newShortWriteTimeoutServer(t, mux)
+
+	resp, err := http.Post(srv.URL+"/api/ingest", "application/json", strings.NewReader(`{"text":"slow to embed"}`))
+	if err := checkStatus("ingest", resp, err, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAskOutlivesWriteTimeout(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, map[string]string{"GENERATION_MODEL": "test-chat"})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, passThrough, passThrough)
+	srv := newShortWriteTimeoutServer(t, mux)
+
+	resp, err := http.Post(srv.URL+"/api/ingest", "application/json", strings.NewReader(`{"text":"something to cite"}`))
+	if err := checkStatus("ingest", resp, err, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+
+	backend.delay = 200 * time.Millisecond
+	resp, err = http.Post(srv.URL+"/api/ask", "application/json", strings.NewReader(`{"question":"what is there?"}`))
+	if err := checkStatus("ask", resp, err, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSlowReadsOutliveWriteTimeout(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, nil)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, passThrough, passThrough)
+	srv := newShortWriteTimeoutServer(t, mux)
+
+	resp, err := http.Post(srv.URL+"/api/ingest", "application/json", strings.NewReader(`{"text":"something to suggest"}`))
+	if err := checkStatus("ingest", resp, err, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	backend.delay = 200 * time.Millisecond
+
+	tests := []struct {
+		name, method, path, body string
+	}{
+		{name: "batch search", method: http.MethodPost, path: "/api/search/batch", body: `{"queries":["something"]}`},
+		{name: "selftest", method: http.MethodPost, path: "/api/selftest"},
+		{name: "corpus stats", method: http.MethodGet, path: "/api/corpus/stats"},
+		{name: "suggest", method: http.MethodGet, path: "/api/suggest?q=sug"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			resp, err := http.DefaultClient.Do(req)
+			if err := checkStatus(tt.name, resp, err, http.StatusOK); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("extract preview", func(t *testing.T) {
+		// The file arrives slowly; nothing on the backend is involved.
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		go func() {
+			part, _ := mw.CreateFormFile("file", "slow.txt")
+			part.Write([]byte("slowly "))
+			time.Sleep(200 * time.Millisecond)
+			part.Write([]byte("arriving text"))
+			mw.Close()
+			pw.Close()
+		}()
+		resp, err := http.Post(srv.URL+"/api/extract/preview", mw.FormDataContentType(), pr)
+		if err := checkStatus("extract preview", resp, err, http.StatusOK); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestMaxChunksPerDocCountsTables(t *testing.T) {
+	extracted := func() *PDFText {
+		return &PDFText{
+			Text: "one two three four five six seven eight nine ten",
+			Tables: []pdfTable{
+				{page: 1, rows: [][]string{{"a", "b"}, {"1", "2"}}},
+				{page: 1, rows: [][]string{{"c", "d"}, {"3", "4"}}},
+			},
+		}
+	}
+	doc := ingestDoc{filename: "tables.pdf", collection: "documents", documentID: "doc-1"}
+
+	t.Run("reject", func(t *testing.T) {
+		backend := newFakeBackend(t)
+		h := newTestHandler(t, backend, map[string]string{"MAX_CHUNKS_PER_DOC": "3"})
+
+		// Two text chunks fit the limit on their own; the tables push it over.
+		_, err := h.ingestExtracted(context.Background(), extracted(), doc, 5, 5, testModel, nil)
+		var ue *uploadError
+		if !errors.As(err, &ue) || ue.status != http.StatusRequestEntityTooLarge {
+			t.Fatalf("err = %v, want a 413 upload error", err)
+		}
+		backend.mu.Lock()
+		defer backend.mu.Unlock()
+		if n := backend.calls["add"]; n != 0 {
+			t.Errorf("made %d add requests for a rejected document", n)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		backend := newFakeBackend(t)
+		h := newTestHandler(t, backend, map[string]string{"MAX_CHUNKS_PER_DOC": "3", "MAX_CHUNKS_MODE": "truncate"})
+
+		result, err := h.ingestExtracted(context.Background(), extracted(), doc, 5, 5, testModel, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Truncated || result.TotalChunks != 4 || result.StoredChunks != 3 {
+			t.Errorf("result = %+v, want 3 of 4 chunks stored and truncated", result)
+		}
+
+		backend.mu.Lock()
+		defer backend.mu.Unlock()
+		kinds := map[string]int{}
+		for _, records := range backend.records {
+			for _, rec := range records {
+				kind, _ := rec.metadata["type"].(string)
+				kinds[kind]++
+			}
+		}
+		if kinds[chunkText] != 2 || kinds[chunkTable] != 1 {
+			t.Errorf("stored chunk types %v, want 2 text and 1 table", kinds)
+		}
+	})
+}
+
+// uploadFile posts content as a multipart upload named filename.
+func uploadFile(t *testing.T, h http.HandlerFunc, filename string, content []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestUploadRejectsBeforeStreaming(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantStatus int
+	}{
+		{name: "too many chunks", content: strings.Repeat("word ", 500), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "no text", content: " \n\t ", wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeBackend(t)
+			h := newTestHandler(t, backend, map[string]string{"MAX_CHUNKS_PER_DOC": "2"})
+
+			rec := uploadFile(t, h.HandleUpload, "notes.txt", []byte(tt.content), map[string]string{"chunkSize": "10", "chunkStride": "10"})
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if strings.Contains(rec.Body.String(), `"status"`) {
+				t.Errorf("progress was streamed before the error: %s", rec.Body)
+			}
+		})
+	}
+}
+
+// endlessReader yields zero bytes forever, counting how many were read.
+type endlessReader struct{ n int64 }
+
+func (e *endlessReader) Read(p []byte) (int, error) {
+	clear(p)
+	e.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestUploadRejectsTypeBeforeStoring(t *testing.T) {
+	tests := []struct {
+		name, filename string
+		path           string
+	}{
+		{name: "extension", filename: "tool.exe", path: "/api/upload"},
+		{name: "content", filename: "report.pdf", path: "/api/upload"},
+		{name: "preview extension", filename: "tool.exe", path: "/api/extract/preview"},
+		{name: "preview content", filename: "report.pdf", path: "/api/extract/preview"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeBackend(t)
+			h := newTestHandler(t, backend, map[string]string{"UPLOAD_MEMORY_THRESHOLD": "1024"})
+			mux := http.NewServeMux()
+			h.RegisterRoutes(mux, passThrough, passThrough)
+
+			// A binary file that never ends: the handler must answer from
+			// its first bytes instead of storing it.
+			var prefix bytes.Buffer
+			mw := multipart.NewWriter(&prefix)
+			mw.CreateFormFile("file", tt.filename)
+			file := &endlessReader{}
+			req := httptest.NewRequest(http.MethodPost, tt.path, io.MultiReader(&prefix, file))
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnsupportedMediaType {
+				t.Fatalf("status %d, want 415: %s", rec.Code, rec.Body)
+			}
+			if file.n > 64<<10 {
+				t.Errorf("read %d bytes of the file before rejecting it", file.n)
+			}
+			entries, err := os.ReadDir(h.config.TempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("temp dir holds %d files after a rejected upload", len(entries))
+			}
+		})
+	}
+}
+
+func TestUploadSpoolsOnceToTempDir(t *testing.T) {
+	systemTemp := t.TempDir()
+	t.Setenv("TMPDIR", systemTemp)
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, map[string]string{"UPLOAD_MEMORY_THRESHOLD": "1024"})
+
+	// While chunks are embedded the upload sits in UPLOAD_TEMP_DIR, and
+	// nowhere else.
+	var mu sync.Mutex
+	var spooled []string
+	var elsewhere int
+	backend.onEmbed = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		entries, _ := os.ReadDir(h.config.TempDir)
+		spooled = spooled[:0]
+		for _, e := range entries {
+			spooled = append(spooled, e.Name())
+		}
+		others, _ := os.ReadDir(systemTemp)
+		elsewhere = len(others)
+	}
+
+	content := []byte(strings.Repeat("word ", 1000))
+	rec := uploadFile(t, h.HandleUpload, "big.txt", content, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"completed"`) {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(spooled) != 1 || !strings.HasPrefix(spooled[0], "upload-") {
+		t.Fatalf("UPLOAD_TEMP_DIR held %v during the upload, want one spooled file", spooled)
+	}
+	if elsewhere != 0 {
+		t.Errorf("the system temp dir held %d files during the upload", elsewhere)
+	}
+	if entries, _ := os.ReadDir(h.config.TempDir); len(entries) != 0 {
+		t.Errorf("UPLOAD_TEMP_DIR holds %d files after the upload", len(entries))
+	}
+}
+
+func TestUploadStreamsProgress(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, nil)
+
+	rec := uploadFile(t, h.HandleUpload, "notes.txt", []byte(strings.Repeat("word ", 50)), map[string]string{"chunkSize": "10", "chunkStride": "10"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	var last map[string]any
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last["status"] != "completed" || last["storedChunks"] != float64(5) {
+		t.Errorf("final line = %v, want 5 stored chunks", last)
+	}
+	if len(lines) < 3 {
+		t.Errorf("got %d lines, want progress before the summary", len(lines))
+	}
+}
+
+// encryptedPDF returns a minimal PDF whose trailer points at the given
+// encryption dictionary.
+func encryptedPDF(encrypt string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		encrypt,
+	}
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	id := strings.Repeat("ab", 16)
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Encrypt 3 0 R /ID [<%s> <%s>] >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, id, id, xref)
+	return b.Bytes()
+}
+
+func TestUploadEncryptedPDF(t *testing.T) {
+	// No password, the empty one included, reproduces this all-zero U value.
+	zeros := strings.Repeat("00", 32)
+	protected := encryptedPDF(fmt.Sprintf("<< /Filter /Standard /V 1 /R 2 /O <%s> /U <%s> /P -4 >>", zeros, zeros))
+	unsupported := encryptedPDF("<< /Filter /Custom >>")
+
+	tests := []struct {
+		name     string
+		content  []byte
+		password string
+		wantMsg  string
+	}{
+		{name: "no password", content: protected, wantMsg: "password-protected"},
+		{name: "wrong password", content: protected, password: "guess", wantMsg: "incorrect password"},
+		{name: "unsupported encryption", content: unsupported, wantMsg: "isn't supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeBackend(t)
+			h := newTestHandler(t, backend, nil)
+
+			rec := uploadFile(t, h.HandleUpload, "secret.pdf", tt.content, map[string]string{"password": tt.password})
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status %d, want 422: %s", rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantMsg) {
+				t.Errorf("body %q doesn't contain %q", rec.Body, tt.wantMsg)
+			}
+			if strings.Contains(rec.Body.String(), `"status"`) {
+				t.Errorf("progress was streamed before the error: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestBatchSearchPreparesQueries(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, map[string]string{"QUERY_STOPWORDS": "en", "NORMALIZE_TEXT": "true"})
+
+	// All three embed as "cat": a stopword is dropped and a soft hyphen normalized away.
+	body := `{"queries":["the cat","ca\u00adt","cat"]}`
+	rec := httptest.NewRecorder()
+	h.HandleBatchSearch(rec, httptest.NewRequest(http.MethodPost, "/api/search/batch", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp BatchSearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 3 || resp.Results[0].Query != "the cat" {
+		t.Errorf("results = %+v, want 3 in input order with the original queries", resp.Results)
+	}
+
+	if got := backend.queriesEmbedded(); len(got) != 1 || got[0] != "cat" {
+		t.Errorf("embedded %q, want just \"cat\"", got)
+	}
+}
+
+func TestSearchPreparesQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *http.Request
+	}{
+		{name: "search", request: httptest.NewRequest(http.MethodGet, "/api/search?q="+url.QueryEscape("the ca\u00adt"), nil)},
+		{name: "ask", request: httptest.NewRequest(http.MethodPost, "/api/ask", strings.NewReader(`{"question":"the ca\u00adt"}`))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeBackend(t)
+			h := newTestHandler(t, backend, map[string]string{"QUERY_STOPWORDS": "en", "NORMALIZE_TEXT": "true", "GENERATION_MODEL": "test-chat"})
+			mux := http.NewServeMux()
+			h.RegisterRoutes(mux, passThrough, passThrough)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, tt.request)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			if got := backend.queriesEmbedded(); len(got) != 1 || got[0] != "cat" {
+				t.Errorf("embedded %q, want just \"cat\"", got)
+			}
+		})
+	}
+}
+
+func TestSearchGivesUpWaitingForEmbedSlot(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, map[string]string{"OLLAMA_MAX_CONCURRENCY": "1"})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, passThrough, passThrough)
+
+	// Hold the only slot, as a stuck embedding call would.
+	h.embedSlots <- struct{}{}
+	defer func() { <-h.embedSlots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=cat", nil).WithContext(ctx))
+		done <- rec
+	}()
+
+	select {
+	case rec := <-done:
+		if rec.Code == http.StatusOK {
+			t.Fatalf("search succeeded without an embed slot: %s", rec.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("search kept waiting for an embed slot after its context ended")
+	}
+	if got := backend.queriesEmbedded(); len(got) != 0 {
+		t.Errorf("embedded %q without a slot", got)
+	}
+}
+
+func TestQueryRetryStopsWithRequest(t *testing.T) {
+	backend := newFakeBackend(t)
+	backend.queryStatus = http.StatusServiceUnavailable
+	h := newTestHandler(t, backend, map[string]string{"QUERY_RETRIES": "5", "QUERY_RETRY_BACKOFF": "1m"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := h.queryChroma(ctx, h.config.Collection, []float32{1, 0}, 1, false, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("query kept retrying for %s after its context ended", elapsed)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if got := backend.calls["query"]; got != 1 {
+		t.Errorf("queried %d times, want 1", got)
+	}
+}
+
+func TestSearchBoostsAfterRerank(t *testing.T) {
+	reranker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reverse the vector order: "plain" becomes the better match.
+		w.Write([]byte(`{"results":[{"index":1,"relevance_score":0.8},{"index":0,"relevance_score":0.5}]}`))
+	}))
+	defer reranker.Close()
+	backend := newFakeBackend(t)
+	backend.query = func(int) any {
+		return map[string]any{
+			"ids":       [][]string{{"urgent", "plain"}},
+			"documents": [][]string{{"urgent text", "plain text"}},
+			"metadatas": [][]any{{map[string]any{"tags": "urgent"}, map[string]any{}}},
+			"distances": [][]float32{{1.2, 1.5}},
+		}
+	}
+	h := newTestHandler(t, backend, map[string]string{"RERANK_URL": reranker.URL})
+
+	rec := httptest.NewRecorder()
+	h.HandleSearch(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=anything&rerank=true&boost=tags=urgent:2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp SearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Reranked || len(resp.Results) != 2 {
+		t.Fatalf("reranked=%v with %d results, want 2 reranked", resp.Reranked, len(resp.Results))
+	}
+	if got := resp.Results[0]; got.ID != "urgent" || got.BoostedScore == nil || *got.BoostedScore != 1 {
+		t.Errorf("top result %s with boosted score %v, want urgent at 0.5*2", got.ID, got.BoostedScore)
+	}
+}
+
+func TestUploadAppendKeepsDocumentName(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, nil)
+
+	rec := httptest.NewRecorder()
+	h.HandleIngest(rec, httptest.NewRequest(http.MethodPost, "/api/ingest",
+		strings.NewReader(`{"text":"first part of the report","filename":"report.md","path":"reports/2024/report.md","chunkSize":10}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest: status %d: %s", rec.Code, rec.Body)
+	}
+	var ingested struct {
+		DocumentID string `json:"documentId"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&ingested); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = uploadFile(t, h.HandleUpload, "appendix.txt", []byte("an appendix added later"), map[string]string{"appendTo": ingested.DocumentID})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("append: status %d: %s", rec.Code, rec.Body)
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	var chunks []fakeRecord
+	for _, records := range backend.records {
+		chunks = append(chunks, records...)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("got %d stored chunks, want 2", len(chunks))
+	}
+	appended := chunks[1].metadata
+	if appended["document_id"] != ingested.DocumentID || appended["filename"] != "report.md" || appended["path"] != "reports/2024/report.md" {
+		t.Errorf("appended chunk metadata = %v, want the original document's id, filename and path", appended)
+	}
+	if appended["chunk_num"] != float64(2) {
+		t.Errorf("appended chunk_num = %v, want 2", appended["chunk_num"])
+	}
+}
+
+func TestAllowedExtensionsMustHaveExtractor(t *testing.T) {
+	backend := newFakeBackend(t)
+	t.Setenv("OLLAMA_URL", backend.URL)
+	t.Setenv("CHROMA_URL", backend.URL)
+	t.Setenv("EMBEDDING_MODELS", testModel)
+
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: ".pdf,.txt,.md"},
+		{spec: "PDF, md"},
+		{spec: ".txt,.docx", wantErr: true},
+		{spec: "html", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			t.Setenv("ALLOWED_EXTENSIONS", tt.spec)
+			cfg, err := LoadConfig("")
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			err = cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "ALLOWED_EXTENSIONS") {
+				t.Errorf("error %q doesn't name ALLOWED_EXTENSIONS", err)
+			}
+		})
+	}
+}
+
+func TestSearchQuotaCharges(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, map[string]string{"QUOTA_IP_SEARCHES": "6"})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, passThrough, passThrough)
+
+	steps := []struct {
+		name, path, body string
+		wantStatus       int
+		wantUsage        string
+	}{
+		{name: "batch of three", path: "/api/search/batch", body: `{"queries":["a","b","c"]}`, wantStatus: http.StatusOK, wantUsage: "search; ip=3/6"},
+		{name: "embed", path: "/api/embed", body: `{"text":"a"}`, wantStatus: http.StatusOK, wantUsage: "search; ip=4/6"},
+		{name: "batch that doesn't fit", path: "/api/search/batch", body: `{"queries":["a","b","c"]}`, wantStatus: http.StatusTooManyRequests, wantUsage: "search; ip=4/6"},
+		{name: "compare", path: "/api/compare", body: `{"a":"x","b":"y"}`, wantStatus: http.StatusOK, wantUsage: "search; ip=6/6"},
+		{name: "embed over quota", path: "/api/embed", body: `{"text":"a"}`, wantStatus: http.StatusTooManyRequests, wantUsage: "search; ip=6/6"},
+	}
+	for _, step := range steps {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, step.path, strings.NewReader(step.body)))
+		if rec.Code != step.wantStatus {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, rec.Code, step.wantStatus, rec.Body)
+		}
+		if got := rec.Header().Get("X-Quota-Usage"); got != step.wantUsage {
+			t.Errorf("%s: X-Quota-Usage %q, want %q", step.name, got, step.wantUsage)
+		}
+	}
+}
+
+func TestReadyFailsFastOnStalledOllama(t *testing.T) {
+	old := readyCheckTimeout
+	readyCheckTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { readyCheckTimeout = old })
+
+	backend := newFakeBackend(t)
+	release := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(stalled.Close)
+	t.Cleanup(func() { close(release) })
+	h := newTestHandler(t, backend, nil)
+	h.config.OllamaURL = stalled.URL
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/api/ready", nil))
+		done <- rec
+	}()
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, want 503: %s", rec.Code, rec.Body)
+		}
+		var resp ReadyResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp.Checks["ollama"] == "ok" || resp.Checks["chroma"] != "ok" {
+			t.Errorf("checks = %v, want ollama failed and chroma ok", resp.Checks)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("readiness hung on a stalled Ollama")
+	}
+}
+
+func TestCorpusStatsDistributions(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, nil)
+
+	rec := httptest.NewRecorder()
+	h.HandleIngest(rec, httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(`{"text":"one two three four","chunkSize":2,"chunkStride":2}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.HandleCorpusStats(rec, httptest.NewRequest(http.MethodGet, "/api/corpus/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp CorpusStatsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	// Every reported distribution is backed by stored metadata.
+	if len(resp.Distributions) != 2 || resp.Distributions["type"][chunkText] != 2 || resp.Distributions["tags"] == nil {
+		t.Errorf("distributions = %v, want type and tags with 2 text chunks", resp.Distributions)
+	}
+}
+
+func TestBatchSearchEmbedBatchesAndCollection(t *testing.T) {
+	backend := newFakeBackend(t)
+	h := newTestHandler(t, backend, map[string]string{"EMBED_BATCH_SIZE": "2"})
+
+	rec := httptest.NewRecorder()
+	h.HandleIngest(rec, httptest.NewRequest(http.MethodPost, "/api/ingest?collection=other", strings.NewReader(`{"text":"stored elsewhere"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest: status %d: %s", rec.Code, rec.Body)
+	}
+	backend.mu.Lock()
+	backend.embedBatches = nil
+	backend.mu.Unlock()
+
+	rec = httptest.NewRecorder()
+	h.HandleBatchSearch(rec, httptest.NewRequest(http.MethodPost, "/api/search/batch?collection=other",
+		strings.NewReader(`{"queries":["a","b","c","d","e"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got := fmt.Sprint(backend.embedBatches); got != "[2 2 1]" {
+		t.Errorf("embedding batches %s, want [2 2 1]", got)
+	}
+	var resp BatchSearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 5 || len(resp.Results[4].Results) != 1 || resp.Results[4].Results[0].Collection != "other" {
+		t.Errorf("results = %+v, want the chunk from collection other for every query", resp.Results)
+	}
+}
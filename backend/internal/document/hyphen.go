@@ -0,0 +1,58 @@
+package document
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// lineBreakHyphen matches a word ending in a hyphen at the end of a line,
+// capturing the word and the start of the next line up to the first
+// character that isn't a letter.
+var lineBreakHyphen = regexp.MustCompile(`(\S*\p{L})-[ \t]*\r?\n[ \t]*(\S\p{L}*)`)
+
+// softHyphenBreak matches a soft hyphen (U+00AD), along with the line break
+// after it if there is one.
+var softHyphenBreak = regexp.MustCompile(`\x{00AD}(?:[ \t]*\r?\n[ \t]*)?`)
+
+// wordPattern matches the runs of letters dehyphenate looks words up by.
+var wordPattern = regexp.MustCompile(`\p{L}+`)
+
+// hyphenVocabulary returns the lowercased words of text, for dehyphenate to
+// check rejoined words against.
+func hyphenVocabulary(text string) map[string]bool {
+	vocab := make(map[string]bool)
+	for _, w := range wordPattern.FindAllString(text, -1) {
+		vocab[strings.ToLower(w)] = true
+	}
+	return vocab
+}
+
+// dehyphenate rejoins words that PDF text breaks across lines with a
+// hyphen, so "exam-\nple" becomes "example". The hyphen is only dropped when
+// the next line continues in lowercase, the word has no other hyphen and the
+// joined word occurs in vocab, the rest of the document; otherwise the two
+// halves are joined keeping it, since "long-\nterm", "COVID-\n19" and
+// "state-of-\nthe-art" are hyphenated compounds. Soft hyphens (U+00AD),
+// which only mark where a word may break, are removed.
+func dehyphenate(text string, vocab map[string]bool) string {
+	text = softHyphenBreak.ReplaceAllString(text, "")
+	return lineBreakHyphen.ReplaceAllStringFunc(text, func(m string) string {
+		sub := lineBreakHyphen.FindStringSubmatch(m)
+		head, next := sub[1], sub[2]
+		r, _ := utf8.DecodeRuneInString(next)
+		if unicode.IsLower(r) && !strings.Contains(head, "-") {
+			// head may carry leading punctuation such as "(".
+			word := head
+			if i := strings.LastIndexFunc(head, func(r rune) bool { return !unicode.IsLetter(r) }); i >= 0 {
+				_, size := utf8.DecodeRuneInString(head[i:])
+				word = head[i+size:]
+			}
+			if vocab[strings.ToLower(word+next)] {
+				return head + next
+			}
+		}
+		return head + "-" + next
+	})
+}
@@ -0,0 +1,168 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// importBatchSize is how many records are sent to Chroma per upsert call.
+const importBatchSize = 500
+
+// maxImportErrors caps how many per-record problems are echoed back to the client.
+const maxImportErrors = 20
+
+// ImportResponse summarizes an /api/import run.
+type ImportResponse struct {
+	Imported  int      `json:"imported"`
+	Skipped   int      `json:"skipped"`
+	Failed    int      `json:"failed"`
+	Dimension int      `json:"dimension"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// HandleImport reads JSONL produced by HandleExport and writes the records to
+// the collection with their stored embeddings, so nothing is re-embedded.
+// Records are upserted by ID, which makes re-running an import safe.
+func (h *Handler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Backups can be large; don't let the server read/write timeouts cut them off.
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("[IMPORT WARNING] Could not clear read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[IMPORT WARNING] Could not clear write deadline: %v", err)
+	}
+
+	colID, err := h.getOrCreateCollection(h.config.Collection)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Vectors must match whatever is already stored, otherwise Chroma rejects them
+	// (or worse, search silently breaks), so take the dimension from an existing record.
+	var resp ImportResponse
+	existing, err := h.getRecords(colID, 0, 1, fullRecord)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if len(existing.Embeddings) > 0 {
+		resp.Dimension = len(existing.Embeddings[0])
+	} else if dim, err := h.detectDimension(); err == nil {
+		// An empty collection will be searched with the default model, so its
+		// vectors must have that model's dimension.
+		resp.Dimension = dim
+	} else {
+		log.Printf("[IMPORT WARNING] %v; taking the dimension from the first record", err)
+	}
+
+	addErr := func(msg string) {
+		if len(resp.Errors) < maxImportErrors {
+			resp.Errors = append(resp.Errors, msg)
+		}
+	}
+
+	batch := make([]ExportRecord, 0, importBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := h.upsertRecords(colID, batch); err != nil {
+			log.Printf("[IMPORT ERROR] Batch of %d failed: %v", len(batch), err)
+			resp.Failed += len(batch)
+			addErr(err.Error())
+		} else {
+			resp.Imported += len(batch)
+		}
+		batch = batch[:0]
+	}
+
+	dec := json.NewDecoder(r.Body)
+	for line := 1; ; line++ {
+		var rec ExportRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			// A malformed line leaves the decoder unusable, so stop here.
+			flush()
+			addErr(fmt.Sprintf("record %d: invalid JSON: %v", line, err))
+			resp.Skipped++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		switch {
+		case rec.ID == "":
+			resp.Skipped++
+			addErr(fmt.Sprintf("record %d: missing id", line))
+			continue
+		case len(rec.Embedding) == 0:
+			resp.Skipped++
+			addErr(fmt.Sprintf("record %d (%s): missing embedding", line, rec.ID))
+			continue
+		case resp.Dimension == 0:
+			resp.Dimension = len(rec.Embedding)
+		case len(rec.Embedding) != resp.Dimension:
+			resp.Skipped++
+			addErr(fmt.Sprintf("record %d (%s): embedding has dimension %d, expected %d", line, rec.ID, len(rec.Embedding), resp.Dimension))
+			continue
+		}
+
+		batch = append(batch, rec)
+		if len(batch) >= importBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	h.suggest.forget(h.config.Collection)
+	log.Printf("[IMPORT COMPLETE] Collection: %s | Imported: %d | Skipped: %d | Failed: %d",
+		h.config.Collection, resp.Imported, resp.Skipped, resp.Failed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// upsertRecords writes records with precomputed embeddings to a collection.
+func (h *Handler) upsertRecords(colID string, records []ExportRecord) error {
+	req := ChromaAddRequest{
+		Documents:  make([]string, 0, len(records)),
+		Metadatas:  make([]interface{}, 0, len(records)),
+		Ids:        make([]string, 0, len(records)),
+		Embeddings: make([][]float32, 0, len(records)),
+	}
+	for _, rec := range records {
+		req.Documents = append(req.Documents, rec.Document)
+		req.Metadatas = append(req.Metadatas, rec.Metadata)
+		req.Ids = append(req.Ids, rec.ID)
+		req.Embeddings = append(req.Embeddings, rec.Embedding)
+	}
+	reqBody, _ := json.Marshal(req)
+
+	url := fmt.Sprintf("%s%s/%s/upsert", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
+	resp, err := h.storeClient.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return fmt.Errorf("http post to %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("chroma upsert returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
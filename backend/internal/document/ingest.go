@@ -0,0 +1,141 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/akhilmk/gowise/internal/httpjson"
+	"github.com/google/uuid"
+)
+
+// IngestRequest is the body of POST /api/ingest.
+type IngestRequest struct {
+	Text           string `json:"text"`
+	Filename       string `json:"filename"`
+	Path           string `json:"path"`
+	ChunkSize      int    `json:"chunkSize"`
+	ChunkStride    int    `json:"chunkStride"`
+	EmbeddingModel string `json:"embeddingModel"`
+}
+
+// HandleIngest stores text sent as JSON, for programmatic ingestion without
+// building a multipart upload. The body is capped at INGEST_MAX_BYTES (413
+// beyond it), which also bounds the text and its chunks held in memory while
+// they are embedded.
+func (h *Handler) HandleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	release, ok := h.acquireUploadSlot(r)
+	if !ok {
+		log.Printf("[INGEST REJECTED] All %d upload slots busy", h.config.MaxConcurrentUploads)
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many concurrent uploads, please retry later", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	// Embedding a large text outlives the server write timeout.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[INGEST WARNING] Could not clear write deadline: %v", err)
+	}
+
+	var req IngestRequest
+	if !httpjson.DecodeLimit(w, r, &req, h.config.IngestMaxBytes) {
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "Invalid request: text is required", http.StatusBadRequest)
+		return
+	}
+	if !utf8.ValidString(req.Text) {
+		http.Error(w, "Invalid request: text must be valid UTF-8", http.StatusBadRequest)
+		return
+	}
+	collection, err := h.requestCollection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := "text"
+	if req.Filename != "" {
+		filename = sanitizeFilename(req.Filename)
+	}
+	filename, err = h.resolveFilename(collection, filename)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errFilenameTaken) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	chunkSize, chunkStride := 100, 80
+	if req.ChunkSize > 0 {
+		chunkSize = req.ChunkSize
+	}
+	if req.ChunkStride > 0 {
+		chunkStride = req.ChunkStride
+	}
+	if chunkStride > chunkSize {
+		chunkStride = chunkSize
+	}
+	embeddingModel := h.config.DefaultModel
+	if req.EmbeddingModel != "" {
+		embeddingModel = req.EmbeddingModel
+	}
+
+	doc := ingestDoc{
+		filename:   filename,
+		path:       normalizeDocPath(req.Path, filename),
+		collection: collection,
+		documentID: uuid.New().String(),
+	}
+	log.Printf("[INGEST START] Name: %s | Size: %d bytes | Chunk size: %d | Stride: %d | Model: %s",
+		filename, len(req.Text), chunkSize, chunkStride, embeddingModel)
+
+	extracted := &PDFText{Text: req.Text, Title: markdownTitle(req.Text), PageWordStarts: []int{0}}
+	result, err := h.ingestExtracted(r.Context(), extracted, doc, chunkSize, chunkStride, embeddingModel, nil)
+	if err != nil {
+		log.Printf("[INGEST ERROR] Name: %s | %v", filename, err)
+		status := http.StatusInternalServerError
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			status = ue.status
+		}
+		http.Error(w, fmt.Sprintf("failed to ingest text: %v", err), status)
+		return
+	}
+
+	log.Printf("[INGEST COMPLETE] Name: %s | Stored %d/%d chunks", filename, result.StoredChunks, result.TotalChunks)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":              "completed",
+		"filename":            filename,
+		"path":                doc.path,
+		"collection":          collection,
+		"documentId":          doc.documentID,
+		"chunkSize":           chunkSize,
+		"chunkStride":         chunkStride,
+		"totalChunks":         result.TotalChunks,
+		"storedChunks":        result.StoredChunks,
+		"droppedChunks":       result.DroppedChunks,
+		"nearDuplicateChunks": result.NearDuplicateChunks,
+		"failedChunks":        result.FailedChunks,
+		"embedFailurePolicy":  h.config.EmbedFailurePolicy,
+		"failures":            result.Failures,
+		"failuresTruncated":   result.FailuresTruncated,
+		"truncated":           result.Truncated,
+		"warnings":            result.Warnings,
+	})
+}
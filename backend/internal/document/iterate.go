@@ -0,0 +1,104 @@
+package document
+
+import (
+	"errors"
+	"sort"
+)
+
+// idPageSize is how many IDs are listed per get call when snapshotting a collection.
+const idPageSize = 5000
+
+// errStopIteration can be returned by an iterateCollection callback to end
+// the iteration early without it being reported as a failure.
+var errStopIteration = errors.New("stop iteration")
+
+// iterateCollection calls fn with successive pages of up to pageSize records,
+// with the given fields included, in ascending ID order.
+//
+// Chroma's get only pages by offset, which skips or repeats records when the
+// collection changes between calls. So the IDs are snapshotted first and the
+// records then fetched by ID: records added during the iteration are not
+// visited, deleted ones are silently left out, and every other record is
+// visited exactly once. Each page is non-empty.
+func (h *Handler) iterateCollection(colID string, pageSize int, include []string, fn func(*ChromaGetRecordsResponse) error) error {
+	ids, err := h.listIDs(colID)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(ids); start += pageSize {
+		end := start + pageSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		page, err := h.chromaGet(colID, map[string]interface{}{
+			"ids":     ids[start:end],
+			"include": include,
+		})
+		if err != nil {
+			return err
+		}
+		page = orderRecords(page, ids[start:end])
+		if len(page.Ids) == 0 {
+			continue
+		}
+		if err := fn(page); err != nil {
+			if errors.Is(err, errStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// listIDs returns every record ID in the collection, sorted and deduplicated.
+func (h *Handler) listIDs(colID string) ([]string, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	for offset := 0; ; offset += idPageSize {
+		page, err := h.getRecords(colID, offset, idPageSize, []string{})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range page.Ids {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(page.Ids) < idPageSize {
+			break
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// orderRecords rearranges a get response into the order of ids, dropping IDs
+// Chroma didn't return (deleted since they were listed).
+func orderRecords(page *ChromaGetRecordsResponse, ids []string) *ChromaGetRecordsResponse {
+	pos := make(map[string]int, len(page.Ids))
+	for i, id := range page.Ids {
+		pos[id] = i
+	}
+
+	out := &ChromaGetRecordsResponse{}
+	for _, id := range ids {
+		i, ok := pos[id]
+		if !ok {
+			continue
+		}
+		out.Ids = append(out.Ids, id)
+		if i < len(page.Documents) {
+			out.Documents = append(out.Documents, page.Documents[i])
+		}
+		if i < len(page.Metadatas) {
+			out.Metadatas = append(out.Metadatas, page.Metadatas[i])
+		}
+		if i < len(page.Embeddings) {
+			out.Embeddings = append(out.Embeddings, page.Embeddings[i])
+		}
+	}
+	return out
+}
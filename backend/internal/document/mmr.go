@@ -0,0 +1,56 @@
+package document
+
+import "math"
+
+// diversifyMMR greedily picks k results using maximal marginal relevance:
+// each step takes the candidate maximising
+//
+//	lambda*sim(query, doc) - (1-lambda)*max(sim(doc, selected))
+//
+// so lambda=1 is pure relevance and lambda=0 is pure diversity. Results without
+// an embedding are treated as having no similarity to anything.
+func diversifyMMR(queryEmbedding []float32, results []SearchResult, k int, lambda float64) []SearchResult {
+	if k > len(results) {
+		k = len(results)
+	}
+
+	query := normalize(queryEmbedding)
+	vectors := make([][]float32, len(results))
+	relevance := make([]float64, len(results))
+	for i, res := range results {
+		vectors[i] = normalize(res.Embedding)
+		relevance[i] = dot(query, vectors[i])
+	}
+
+	selected := make([]int, 0, k)
+	used := make([]bool, len(results))
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range results {
+			if used[i] {
+				continue
+			}
+			redundancy := 0.0
+			for _, j := range selected {
+				if sim := dot(vectors[i], vectors[j]); sim > redundancy {
+					redundancy = sim
+				}
+			}
+			score := lambda*relevance[i] - (1-lambda)*redundancy
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		used[best] = true
+		selected = append(selected, best)
+	}
+
+	out := make([]SearchResult, len(selected))
+	for i, idx := range selected {
+		out[i] = results[idx]
+	}
+	return out
+}
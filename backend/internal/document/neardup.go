@@ -0,0 +1,98 @@
+package document
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+const (
+	// shingleWords is the length of the word n-grams compared between chunks.
+	shingleWords = 3
+	// minHashSize is the number of hash functions in a MinHash signature; the
+	// Jaccard estimate has a standard error of roughly 1/sqrt(minHashSize).
+	minHashSize = 64
+)
+
+// minHashSignature summarizes the set of word shingles in text. Two signatures
+// agree in a fraction of positions approximately equal to the Jaccard
+// similarity of the underlying shingle sets.
+func minHashSignature(text string) []uint64 {
+	words := strings.Fields(strings.ToLower(text))
+	sig := make([]uint64, minHashSize)
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+
+	n := shingleWords
+	if len(words) < n {
+		n = len(words)
+	}
+	for i := 0; i+n <= len(words) && n > 0; i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+n], " ")))
+		base := h.Sum64()
+		for j := range sig {
+			// Cheap family of hash functions derived from one base hash.
+			v := mix64(base ^ (uint64(j+1) * 0x9e3779b97f4a7c15))
+			if v < sig[j] {
+				sig[j] = v
+			}
+		}
+	}
+	return sig
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// estimateJaccard returns the fraction of matching positions in two signatures.
+func estimateJaccard(a, b []uint64) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// filterNearDuplicates drops chunks whose estimated shingle similarity to one
+// of the last `window` kept chunks of the same document is at least threshold.
+// It returns the remaining chunks and how many were dropped.
+func filterNearDuplicates(chunks []textChunk, threshold float64, window int) ([]textChunk, int) {
+	kept := make([]textChunk, 0, len(chunks))
+	recent := make([][]uint64, 0, window)
+	removed := 0
+
+	for _, chunk := range chunks {
+		sig := minHashSignature(chunk.Text)
+		duplicate := false
+		for _, prev := range recent {
+			if estimateJaccard(sig, prev) >= threshold {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			removed++
+			continue
+		}
+
+		kept = append(kept, chunk)
+		if window > 0 {
+			if len(recent) == window {
+				recent = recent[1:]
+			}
+			recent = append(recent, sig)
+		}
+	}
+	return kept, removed
+}
@@ -0,0 +1,68 @@
+package document
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeText cleans extracted text or a query for embedding: Unicode is
+// normalized to NFC, control and format characters (NUL, zero-width spaces,
+// soft hyphens and the like) are removed, and every run of whitespace,
+// including form feeds and non-breaking spaces, becomes a single space.
+func normalizeText(s string) string {
+	s = norm.NFC.String(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+			continue
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// normalizeExtracted applies normalizeText to extracted text, its title and
+// its table cells. The text is normalized word by word so PageWordStarts
+// stay valid: a word that normalizes to nothing is dropped and the page
+// starts after it are shifted down.
+func normalizeExtracted(t *PDFText) {
+	words := strings.Fields(t.Text)
+	kept := make([]string, 0, len(words))
+	starts := append([]int(nil), t.PageWordStarts...)
+	page := 0
+	for i, w := range words {
+		for page < len(starts) && t.PageWordStarts[page] <= i {
+			starts[page] = len(kept)
+			page++
+		}
+		if w = normalizeText(w); w != "" {
+			kept = append(kept, w)
+		}
+	}
+	for ; page < len(starts); page++ {
+		starts[page] = len(kept)
+	}
+	t.Text = strings.Join(kept, " ")
+	t.PageWordStarts = starts
+	t.Title = normalizeText(t.Title)
+
+	for _, table := range t.Tables {
+		for _, row := range table.rows {
+			for i, cell := range row {
+				row[i] = normalizeText(cell)
+			}
+		}
+	}
+}
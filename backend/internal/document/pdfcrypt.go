@@ -0,0 +1,42 @@
+package document
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// openPDF opens a PDF, trying password if the file is encrypted. Encrypted
+// files that can't be opened are reported as 422 upload errors explaining
+// why, instead of the library's bare "invalid password".
+func openPDF(src io.ReaderAt, size int64, password string) (*pdf.Reader, error) {
+	tried := false
+	r, err := pdf.NewReaderEncrypted(src, size, func() string {
+		if tried {
+			return ""
+		}
+		tried = true
+		return password
+	})
+	if err == nil {
+		return r, nil
+	}
+
+	switch {
+	case err == pdf.ErrInvalidPassword && password == "":
+		return nil, &uploadError{
+			status: http.StatusUnprocessableEntity,
+			msg:    "PDF is password-protected; upload it again with its password in the \"password\" field",
+		}
+	case err == pdf.ErrInvalidPassword:
+		return nil, &uploadError{status: http.StatusUnprocessableEntity, msg: "incorrect password for encrypted PDF"}
+	case strings.Contains(err.Error(), "encryption"):
+		return nil, &uploadError{
+			status: http.StatusUnprocessableEntity,
+			msg:    "PDF uses an encryption scheme that isn't supported (" + err.Error() + "); remove the protection and upload it again",
+		}
+	}
+	return nil, err
+}
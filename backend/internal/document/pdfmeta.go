@@ -0,0 +1,74 @@
+package document
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfInfo returns an entry of the PDF's document information dictionary,
+// or "" when the PDF has no such entry (or no dictionary at all).
+func pdfInfo(r *pdf.Reader, key string) string {
+	return strings.TrimSpace(r.Trailer().Key("Info").Key(key).Text())
+}
+
+// pdfTitle returns the Title entry of the PDF's document information dictionary.
+func pdfTitle(r *pdf.Reader) string {
+	return pdfInfo(r, "Title")
+}
+
+// pdfCreated parses the CreationDate entry, a PDF date string such as
+// "D:20240501123000+02'00'". Every part after the year is optional; a missing
+// or unparseable date yields the zero time.
+func pdfCreated(r *pdf.Reader) time.Time {
+	return parsePDFDate(pdfInfo(r, "CreationDate"))
+}
+
+func parsePDFDate(s string) time.Time {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	// The timezone is "Z", or "+HH'mm'" / "-HH'mm'" with optional apostrophes.
+	digits, zone := s, ""
+	if i := strings.IndexAny(s, "Z+-"); i >= 0 {
+		digits, zone = s[:i], s[i:]
+	}
+	// Pad the omitted fields with their defaults: month and day 01, time 00:00:00.
+	const defaults = "0101000000"
+	if len(digits) < 4 || len(digits) > 14 {
+		return time.Time{}
+	}
+	digits += defaults[len(digits)-4:]
+
+	loc := time.UTC
+	zone = strings.ReplaceAll(zone, "'", "")
+	if len(zone) == 3 {
+		zone += "00"
+	}
+	if len(zone) == 5 {
+		if offset, err := time.Parse("-0700", zone); err == nil {
+			_, secs := offset.Zone()
+			loc = time.FixedZone("", secs)
+		}
+	}
+	t, err := time.ParseInLocation("20060102150405", digits, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// addDocumentMetadata stores the document's own title, author and creation
+// date on a chunk as doc_title, doc_author and doc_created (RFC3339, plus
+// doc_created_unix for range filters). Missing values are left out.
+func addDocumentMetadata(meta map[string]interface{}, doc ingestDoc) {
+	if doc.title != "" {
+		meta["doc_title"] = doc.title
+	}
+	if doc.author != "" {
+		meta["doc_author"] = doc.author
+	}
+	if !doc.created.IsZero() {
+		meta["doc_created"] = doc.created.Format(time.RFC3339)
+		meta["doc_created_unix"] = doc.created.Unix()
+	}
+}
@@ -0,0 +1,125 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultPreviewChars = 2000
+	maxPreviewChars     = 100000
+)
+
+// ExtractPreviewResponse describes what the extractor made of a file.
+type ExtractPreviewResponse struct {
+	Filename string `json:"filename"`
+	// Format is the extractor used: "pdf" or "text".
+	Format      string `json:"format"`
+	ContentType string `json:"contentType"`
+	Pages       int    `json:"pages"`
+	// TotalLength and Words cover the whole extracted text.
+	TotalLength int    `json:"totalLength"`
+	Words       int    `json:"words"`
+	Tables      int    `json:"tables"`
+	Title       string `json:"title,omitempty"`
+	// Text is the first Limit characters of the extracted text.
+	Text      string `json:"text"`
+	Limit     int    `json:"limit"`
+	Truncated bool   `json:"truncated"`
+	Warning   string `json:"warning,omitempty"`
+}
+
+// HandleExtractPreview runs only the extractor on an uploaded file and
+// returns the start of the raw extracted text, before normalization,
+// chunking or embedding, to judge extraction quality before ingesting.
+func (h *Handler) HandleExtractPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extraction is as expensive as the first half of an upload, so it
+	// shares the upload slots.
+	release, ok := h.acquireUploadSlot(r)
+	if !ok {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many concurrent uploads, please retry later", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	// Receiving and extracting a large file outlives the server's read/write
+	// timeouts, as an upload does.
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("[PREVIEW WARNING] Could not clear read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[PREVIEW WARNING] Could not clear write deadline: %v", err)
+	}
+
+	form, err := h.readUploadForm(r)
+	if err != nil {
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			http.Error(w, ue.msg, ue.status)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer form.Close()
+
+	limit := defaultPreviewChars
+	if l := form.FormValue("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxPreviewChars {
+			limit = parsed
+		}
+	}
+
+	extracted, err := h.extract(form.src, form.size, form.filename, form.FormValue("password"), nil)
+	if err != nil {
+		log.Printf("[PREVIEW ERROR] File: %s | %v", form.filename, err)
+		status := http.StatusUnprocessableEntity
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			status = ue.status
+		}
+		http.Error(w, fmt.Sprintf("failed to extract text: %v", err), status)
+		return
+	}
+
+	resp := ExtractPreviewResponse{
+		Filename:    form.filename,
+		Format:      "pdf",
+		ContentType: http.DetectContentType(form.head),
+		Pages:       len(extracted.PageWordStarts),
+		TotalLength: utf8.RuneCountInString(extracted.Text),
+		Words:       len(strings.Fields(extracted.Text)),
+		Tables:      len(extracted.Tables),
+		Title:       extracted.Title,
+		Text:        extracted.Text,
+		Limit:       limit,
+	}
+	if isPlainText(form.ext) {
+		resp.Format = "text"
+	}
+	if resp.TotalLength > limit {
+		resp.Text = string([]rune(extracted.Text)[:limit])
+		resp.Truncated = true
+	}
+	if strings.TrimSpace(extracted.Text) == "" {
+		resp.Warning = "no text extracted; the file might be scanned or image-based"
+	}
+
+	log.Printf("[PREVIEW] File: %s | %d chars, %d pages", form.filename, resp.TotalLength, resp.Pages)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,25 @@
+package document
+
+import "slices"
+
+// readRoutes are the routes that never modify a collection. Only these may
+// be listed in PUBLIC_ROUTES; a read route missing here simply can't be made
+// public, which fails safe.
+var readRoutes = []string{
+	"/api/search",
+	"/api/suggest",
+	"/api/search/batch",
+	"/api/ask",
+	"/api/stats",
+	"/api/corpus/stats",
+	"/api/export",
+	"/api/models",
+	"/api/info",
+	"/api/embed",
+	"/api/compare",
+}
+
+// isPublic reports whether PUBLIC_ROUTES exempts the route from authentication.
+func (c Config) isPublic(path string) bool {
+	return slices.Contains(c.PublicRoutes, path)
+}
@@ -0,0 +1,178 @@
+package document
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akhilmk/gowise/internal/auth"
+)
+
+// Request kinds with separate quotas.
+const (
+	quotaUpload = "upload"
+	quotaSearch = "search"
+)
+
+// quotaTracker counts requests per key over fixed windows of QuotaWindow.
+// Each key's window starts at its first request; idle keys are pruned
+// periodically so the map doesn't grow without bound.
+type quotaTracker struct {
+	mu      sync.Mutex
+	window  time.Duration
+	buckets map[string]*quotaBucket
+}
+
+type quotaBucket struct {
+	start time.Time
+	count int
+}
+
+func newQuotaTracker(window time.Duration) *quotaTracker {
+	t := &quotaTracker{window: window, buckets: make(map[string]*quotaBucket)}
+	go t.pruneLoop()
+	return t
+}
+
+func (t *quotaTracker) pruneLoop() {
+	ticker := time.NewTicker(t.window)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		t.mu.Lock()
+		for key, b := range t.buckets {
+			if now.Sub(b.start) >= t.window {
+				delete(t.buckets, key)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// quotaCheck is one limit applied to a request.
+type quotaCheck struct {
+	scope string // "user" or "ip", reported in the usage header
+	key   string
+	limit int
+}
+
+// quotaUsage is the state of one check after a request was counted (or refused).
+type quotaUsage struct {
+	scope     string
+	used      int
+	limit     int
+	resetsIn  time.Duration
+	exhausted bool
+}
+
+// take counts n units against every check, but only if all of them have n
+// units left; a refused request doesn't consume quota.
+func (t *quotaTracker) take(checks []quotaCheck, n int) (usage []quotaUsage, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	ok = true
+	buckets := make([]*quotaBucket, len(checks))
+	for i, c := range checks {
+		b := t.buckets[c.key]
+		if b == nil || now.Sub(b.start) >= t.window {
+			b = &quotaBucket{start: now}
+			t.buckets[c.key] = b
+		}
+		buckets[i] = b
+		if b.count+n > c.limit {
+			ok = false
+		}
+	}
+
+	for i, c := range checks {
+		b := buckets[i]
+		exhausted := b.count+n > c.limit
+		if ok {
+			b.count += n
+			exhausted = b.count >= c.limit
+		}
+		usage = append(usage, quotaUsage{
+			scope:     c.scope,
+			used:      b.count,
+			limit:     c.limit,
+			resetsIn:  b.start.Add(t.window).Sub(now),
+			exhausted: exhausted,
+		})
+	}
+	return usage, ok
+}
+
+// quotaChecks returns the limits that apply to a request of the given kind.
+func (h *Handler) quotaChecks(r *http.Request, kind string) []quotaCheck {
+	userLimit, ipLimit := h.config.UserSearchQuota, h.config.IPSearchQuota
+	if kind == quotaUpload {
+		userLimit, ipLimit = h.config.UserUploadQuota, h.config.IPUploadQuota
+	}
+
+	var checks []quotaCheck
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && userLimit > 0 && claims.Username != "" {
+		checks = append(checks, quotaCheck{scope: "user", key: kind + "|user|" + claims.Username, limit: userLimit})
+	}
+	if ipLimit > 0 {
+		checks = append(checks, quotaCheck{scope: "ip", key: kind + "|ip|" + clientIP(r), limit: ipLimit})
+	}
+	return checks
+}
+
+// withQuota enforces the per-user and per-IP quotas for kind, charging one
+// unit per request. It must run inside the auth middleware to see the user.
+func (h *Handler) withQuota(kind string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.chargeQuota(w, r, kind, 1) {
+			next(w, r)
+		}
+	}
+}
+
+// chargeQuota counts n units against the per-user and per-IP quotas for
+// kind, for handlers whose cost depends on the request, and answers 429 if
+// either hasn't n units left. Every counted response carries X-Quota-Usage
+// with the current counts. It reports whether the request may go ahead.
+func (h *Handler) chargeQuota(w http.ResponseWriter, r *http.Request, kind string, n int) bool {
+	if h.quotas == nil {
+		return true
+	}
+	checks := h.quotaChecks(r, kind)
+	if len(checks) == 0 {
+		return true
+	}
+
+	usage, ok := h.quotas.take(checks, n)
+	parts := make([]string, len(usage))
+	var retryAfter time.Duration
+	for i, u := range usage {
+		parts[i] = fmt.Sprintf("%s=%d/%d", u.scope, u.used, u.limit)
+		if u.exhausted && u.resetsIn > retryAfter {
+			retryAfter = u.resetsIn
+		}
+	}
+	w.Header().Set("X-Quota-Usage", kind+"; "+strings.Join(parts, "; "))
+
+	if !ok {
+		log.Printf("[QUOTA] %s quota exceeded for %s (%s, %d requested)", kind, clientIP(r), strings.Join(parts, ", "), n)
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, fmt.Sprintf("%s quota exceeded, please retry later", kind), http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// clientIP returns the host part of the connection's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,434 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/akhilmk/gowise/internal/httpjson"
+)
+
+// AskRequest is the payload for HandleAsk.
+type AskRequest struct {
+	Question string `json:"question"`
+	K        int    `json:"k"`
+}
+
+// AskResponse carries the generated answer and the chunks it was grounded on.
+type AskResponse struct {
+	Question  string         `json:"question"`
+	Answer    string         `json:"answer"`
+	Model     string         `json:"model"`
+	Sources   []SearchResult `json:"sources"`
+	Citations []Citation     `json:"citations"`
+	// Fallback is set when retrieval was too weak and the canned answer was returned without generation.
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+// Citation maps a passage number used in the prompt (and cited as [n] in the
+// answer) back to the chunk it came from.
+type Citation struct {
+	Number   int    `json:"number"`
+	ChunkID  string `json:"chunk_id"`
+	Filename string `json:"filename"`
+	ChunkNum int    `json:"chunk_num,omitempty"`
+	Page     int    `json:"page,omitempty"`
+	PageEnd  int    `json:"page_end,omitempty"`
+	// Title and Author are the source document's own, when its metadata has them.
+	Title  string `json:"title,omitempty"`
+	Author string `json:"author,omitempty"`
+	// Cited reports whether the answer actually references this passage.
+	Cited bool `json:"cited"`
+}
+
+var citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// GenerateRequest is the body for Ollama's /api/generate.
+type GenerateRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	Stream bool   `json:"stream"`
+}
+
+// GenerateResponse is a (possibly partial) /api/generate response.
+type GenerateResponse struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+}
+
+// HandleAsk answers a question from the indexed documents: it retrieves the
+// top-k chunks, builds a numbered-context prompt and asks the generation model.
+func (h *Handler) HandleAsk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.config.GenerationModel == "" {
+		http.Error(w, "GENERATION_MODEL is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req AskRequest
+	if !httpjson.Decode(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Question) == "" {
+		http.Error(w, "Missing field 'question'", http.StatusBadRequest)
+		return
+	}
+	topK := req.K
+	if topK <= 0 || topK > maxTopK {
+		topK = h.config.RAGRetrieveK
+	}
+
+	log.Printf("[ASK] Question: %s", req.Question)
+
+	retrieved, err := h.retrieve(r.Context(), req.Question, topK)
+	if err != nil {
+		http.Error(w, err.Error(), collectionErrorStatus(err))
+		return
+	}
+
+	// Answering from weakly related chunks invites hallucination, so below the
+	// similarity floor skip the model entirely.
+	if h.config.AskMinScore > 0 {
+		if best := bestScore(retrieved); best < h.config.AskMinScore {
+			log.Printf("[ASK] Best match score %.3f is below the %.3f floor; returning fallback answer", best, h.config.AskMinScore)
+			h.writeFallbackAnswer(w, r, req.Question)
+			return
+		}
+	}
+	sources := assembleContext(retrieved, h.config.ContextTokenBudget)
+	if len(sources) < len(retrieved) {
+		log.Printf("[ASK] Packed %d/%d chunks into a %d-token context budget", len(sources), len(retrieved), h.config.ContextTokenBudget)
+	}
+
+	// r.Context() is cancelled when the client goes away, which aborts the
+	// upstream generate call as well.
+	ctx, cancel := context.WithTimeout(r.Context(), h.config.GenerationTimeout)
+	defer cancel()
+
+	prompt, err := h.buildPrompt(req.Question, sources)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// GENERATION_TIMEOUT bounds generation and may exceed the server's write
+	// timeout, streamed or not.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[ASK WARNING] Could not clear write deadline: %v", err)
+	}
+	if wantsStream(r) {
+		h.streamAnswer(ctx, w, req.Question, prompt, sources)
+		return
+	}
+
+	answer, err := h.generate(ctx, prompt)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to generate answer: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AskResponse{
+		Question:  req.Question,
+		Answer:    answer,
+		Model:     h.config.GenerationModel,
+		Sources:   sources,
+		Citations: buildCitations(sources, answer),
+	})
+}
+
+// wantsStream reports whether the client asked for Server-Sent Events.
+func wantsStream(r *http.Request) bool {
+	return r.URL.Query().Get("stream") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// bestScore returns the highest similarity among results (0 if there are none).
+func bestScore(results []SearchResult) float32 {
+	var best float32
+	for _, res := range results {
+		if res.Score > best {
+			best = res.Score
+		}
+	}
+	return best
+}
+
+// writeFallbackAnswer replies with the configured "not enough information"
+// answer, using the same shape as a generated one.
+func (h *Handler) writeFallbackAnswer(w http.ResponseWriter, r *http.Request, question string) {
+	resp := AskResponse{
+		Question:  question,
+		Answer:    h.config.AskFallbackMessage,
+		Sources:   []SearchResult{},
+		Citations: []Citation{},
+		Fallback:  true,
+	}
+	if wantsStream(r) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		payload, _ := json.Marshal(resp)
+		fmt.Fprintf(w, "event: done\ndata: %s\n\n", payload)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// buildCitations numbers sources in prompt order and flags the ones the answer cites.
+func buildCitations(sources []SearchResult, answer string) []Citation {
+	cited := make(map[int]bool)
+	for _, m := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			cited[n] = true
+		}
+	}
+
+	citations := make([]Citation, len(sources))
+	for i, src := range sources {
+		filename, _ := src.Metadata["filename"].(string)
+		title, _ := src.Metadata["doc_title"].(string)
+		author, _ := src.Metadata["doc_author"].(string)
+		citations[i] = Citation{
+			Number:   i + 1,
+			ChunkID:  src.ID,
+			Filename: filename,
+			ChunkNum: metadataInt(src.Metadata, "chunk_num"),
+			Page:     metadataInt(src.Metadata, "page"),
+			PageEnd:  metadataInt(src.Metadata, "page_end"),
+			Title:    title,
+			Author:   author,
+			Cited:    cited[i+1],
+		}
+	}
+	return citations
+}
+
+// metadataInt reads a numeric metadata field, which arrives from JSON as float64.
+func metadataInt(meta map[string]interface{}, key string) int {
+	switch v := meta[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// retrieve embeds the question and returns the top-k matching chunks.
+func (h *Handler) retrieve(ctx context.Context, question string, topK int) ([]SearchResult, error) {
+	embedding, err := h.embedQuery(ctx, question, h.config.DefaultModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embedding: %w", err)
+	}
+	res, err := h.queryChroma(ctx, h.config.Collection, embedding, topK, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chroma: %w", err)
+	}
+	return toSearchResults(res, 0, h.config.Collection, h.score), nil
+}
+
+// PromptContext is one numbered passage available to prompt templates.
+type PromptContext struct {
+	Number   int
+	Filename string
+	Page     int
+	Text     string
+}
+
+// PromptData is the data passed to the ask prompt template.
+type PromptData struct {
+	Question string
+	Contexts []PromptContext
+}
+
+// defaultPromptTemplate numbers each passage so the model can cite it as [n].
+const defaultPromptTemplate = `Answer the question using only the numbered context passages below. Cite the passages you use as [n]. If the context does not contain the answer, say you don't know.
+
+Context:
+{{range .Contexts}}[{{.Number}}] ({{.Filename}}{{if .Page}}, p.{{.Page}}{{end}})
+{{.Text}}
+
+{{end}}Question: {{.Question}}
+Answer:`
+
+// loadPromptTemplate parses the template at path (or the built-in default when
+// path is empty) and test-renders it so mistakes surface at startup.
+func loadPromptTemplate(path string) (*template.Template, error) {
+	text := defaultPromptTemplate
+	name := "default"
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		text = string(data)
+		name = filepath.Base(path)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+
+	sample := PromptData{
+		Question: "sample question",
+		Contexts: []PromptContext{{Number: 1, Filename: "sample.pdf", Page: 1, Text: "sample passage"}},
+	}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// buildPrompt renders the configured template with the numbered passages.
+func (h *Handler) buildPrompt(question string, sources []SearchResult) (string, error) {
+	data := PromptData{Question: question, Contexts: make([]PromptContext, len(sources))}
+	for i, src := range sources {
+		filename, _ := src.Metadata["filename"].(string)
+		data.Contexts[i] = PromptContext{
+			Number:   i + 1,
+			Filename: filename,
+			Page:     metadataInt(src.Metadata, "page"),
+			Text:     src.Document,
+		}
+	}
+
+	var b strings.Builder
+	if err := h.promptTemplate.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+	return b.String(), nil
+}
+
+// streamAnswer relays generated tokens to the client as Server-Sent Events:
+// "token" events carry text as it arrives and a final "done" event carries the
+// sources. Failures after the stream starts are sent as an "error" event.
+func (h *Handler) streamAnswer(ctx context.Context, w http.ResponseWriter, question, prompt string, sources []SearchResult) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(event string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+
+	var answer strings.Builder
+	err := h.generateStream(ctx, prompt, func(token string) {
+		answer.WriteString(token)
+		send("token", map[string]string{"token": token})
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("[ASK] Stream stopped: %v", ctx.Err())
+		}
+		send("error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	send("done", AskResponse{
+		Question:  question,
+		Answer:    strings.TrimSpace(answer.String()),
+		Model:     h.config.GenerationModel,
+		Sources:   sources,
+		Citations: buildCitations(sources, answer.String()),
+	})
+}
+
+// generateStream runs a streaming completion and calls onToken for every
+// partial response until Ollama reports done or ctx is cancelled.
+func (h *Handler) generateStream(ctx context.Context, prompt string, onToken func(string)) error {
+	reqBody, _ := json.Marshal(GenerateRequest{
+		Model:  h.config.GenerationModel,
+		Prompt: prompt,
+		Stream: true,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.OllamaURL+"/api/generate", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http post error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk GenerateResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to decode stream: %w", err)
+		}
+		if chunk.Response != "" {
+			onToken(chunk.Response)
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+}
+
+// generate runs a non-streaming completion against Ollama.
+func (h *Handler) generate(ctx context.Context, prompt string) (string, error) {
+	reqBody, _ := json.Marshal(GenerateRequest{
+		Model:  h.config.GenerationModel,
+		Prompt: prompt,
+		Stream: false,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.OllamaURL+"/api/generate", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("http post error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var res GenerateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return strings.TrimSpace(res.Response), nil
+}
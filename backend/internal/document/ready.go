@@ -0,0 +1,176 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// readyCheckTimeout bounds each reachability check, so a stalled dependency
+// fails the probe instead of hanging it.
+var readyCheckTimeout = 3 * time.Second
+
+// ReadyResponse reports whether the service's dependencies are usable.
+type ReadyResponse struct {
+	Status      string            `json:"status"`
+	Checks      map[string]string `json:"checks"`
+	ModelLoaded bool              `json:"model_loaded"`
+	// EmbeddingDim is the default model's embedding dimension, once known.
+	EmbeddingDim int `json:"embedding_dim,omitempty"`
+}
+
+// HandleReady checks that Ollama and Chroma are reachable, that the upload
+// temp dir is usable, and whether the default embedding model is already
+// loaded in Ollama's memory. With DEEP_READINESS it also runs probeQuery.
+func (h *Handler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	checks := make(map[string]string)
+	ready := true
+	record := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+
+	record("chroma", h.checkChroma(r.Context()))
+	record("temp_dir", h.checkTempDir())
+
+	loaded, err := h.modelLoaded(r.Context(), h.config.DefaultModel)
+	record("ollama", err)
+	if err == nil && !loaded {
+		if h.config.ReadyRequiresModel {
+			checks["model"] = fmt.Sprintf("model %s is not loaded yet", h.config.DefaultModel)
+			ready = false
+		} else {
+			checks["model"] = "not loaded (first request will be slow)"
+		}
+	} else if loaded {
+		checks["model"] = "ok"
+	}
+
+	if h.config.DeepReadiness {
+		record("probe", h.probeQuery(r.Context()))
+	}
+
+	resp := ReadyResponse{Status: "ready", Checks: checks, ModelLoaded: loaded}
+	// Probing an unloaded model would make readiness wait for it to load, so
+	// only a loaded model is asked; detection failures don't affect readiness.
+	resp.EmbeddingDim = h.knownDimension()
+	if resp.EmbeddingDim == 0 && loaded {
+		resp.EmbeddingDim, _ = h.detectDimension()
+	}
+	status := http.StatusOK
+	if !ready {
+		resp.Status = "not_ready"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readinessProbe is the sentinel text embedded by probeQuery.
+const readinessProbe = "readiness probe"
+
+// probeQuery checks the real search path end to end: it embeds a sentinel
+// query with the default model and queries the default collection with it,
+// which catches a wrong model, API base or dimension that reachability
+// checks miss. A collection that doesn't exist yet is not created and, like
+// an empty one, only proves the collection lookup works.
+func (h *Handler) probeQuery(ctx context.Context) error {
+	embedding, err := h.embedQuery(ctx, readinessProbe, h.config.DefaultModel)
+	if err != nil {
+		return fmt.Errorf("embedding failed: %w", err)
+	}
+	if _, err := h.findCollection(h.config.Collection); err != nil {
+		if errors.Is(err, ErrCollectionNotFound) {
+			return nil
+		}
+		return fmt.Errorf("collection lookup failed: %w", err)
+	}
+	if _, err := h.queryChromaOnce(ctx, h.config.Collection, [][]float32{embedding}, 1, false, nil); err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) checkChroma(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.config.ChromaURL+"/api/v2/heartbeat", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.storeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("heartbeat returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// modelLoaded asks Ollama's running-models endpoint whether model is in memory.
+func (h *Handler) modelLoaded(ctx context.Context, model string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.config.OllamaURL+"/api/ps", nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("ps returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var ps struct {
+		Models []struct {
+			Name  string `json:"name"`
+			Model string `json:"model"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return false, fmt.Errorf("failed to decode ps response: %w", err)
+	}
+
+	for _, m := range ps.Models {
+		if sameModel(m.Name, model) || sameModel(m.Model, model) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sameModel compares Ollama model names, treating a missing tag as ":latest".
+func sameModel(a, b string) bool {
+	if !strings.Contains(a, ":") {
+		a += ":latest"
+	}
+	if !strings.Contains(b, ":") {
+		b += ":latest"
+	}
+	return a == b
+}
@@ -0,0 +1,122 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/akhilmk/gowise/internal/httpjson"
+)
+
+var (
+	// errRenameUnsupported means Chroma has no collection update endpoint.
+	errRenameUnsupported = errors.New("this ChromaDB does not support renaming collections")
+	errCollectionExists  = errors.New("collection already exists")
+)
+
+// RenameCollectionRequest is the body of POST /api/collections/rename.
+type RenameCollectionRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// HandleRenameCollection renames a collection in place through Chroma's
+// collection update endpoint, keeping its records and embeddings. The
+// default collection can't be renamed, since the next write would just
+// create a new, empty one under COLLECTION_NAME.
+func (h *Handler) HandleRenameCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RenameCollectionRequest
+	if !httpjson.Decode(w, r, &req) {
+		return
+	}
+	for _, name := range []string{req.From, req.To} {
+		if !validCollectionName(name) || !validCollectionName(h.config.chromaName(name)) {
+			http.Error(w, fmt.Sprintf("invalid collection name %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.From == req.To {
+		http.Error(w, "from and to must differ", http.StatusBadRequest)
+		return
+	}
+	if req.From == h.config.Collection {
+		http.Error(w, fmt.Sprintf("the default collection %q can't be renamed", req.From), http.StatusBadRequest)
+		return
+	}
+
+	colID, err := h.findCollection(req.From)
+	if err != nil {
+		http.Error(w, err.Error(), collectionErrorStatus(err))
+		return
+	}
+	if _, err := h.findCollection(req.To); err == nil {
+		http.Error(w, fmt.Sprintf("%v: %s", errCollectionExists, req.To), http.StatusConflict)
+		return
+	} else if !errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if err := h.renameCollection(colID, req.To); err != nil {
+		log.Printf("[RENAME ERROR] %s -> %s: %v", req.From, req.To, err)
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, errRenameUnsupported):
+			status = http.StatusNotImplemented
+		case errors.Is(err, errCollectionExists):
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	h.suggest.forget(req.From)
+	h.suggest.forget(req.To)
+
+	log.Printf("[RENAME] Renamed collection %s to %s (%s)", req.From, req.To, colID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":       "renamed",
+		"from":         req.From,
+		"to":           req.To,
+		"collectionId": colID,
+	})
+}
+
+// renameCollection gives the collection with ID colID the API-facing name
+// to. A Chroma without the update endpoint yields errRenameUnsupported.
+func (h *Handler) renameCollection(colID, to string) error {
+	url := fmt.Sprintf("%s%s/%s", h.config.ChromaURL, h.config.ChromaAPIBase, colID)
+	reqBody, _ := json.Marshal(map[string]string{"new_name": h.config.chromaName(to)})
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.storeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to PUT %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return fmt.Errorf("%w (update returned status %d)", errRenameUnsupported, resp.StatusCode)
+	case http.StatusConflict:
+		return fmt.Errorf("%w: %s", errCollectionExists, to)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("update collection returned status %d: %s", resp.StatusCode, string(body))
+}
@@ -0,0 +1,81 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// RerankRequest is the Cohere/Jina-style payload sent to RERANK_URL.
+type RerankRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+// RerankResponse holds the reranker's relevance score per input document index.
+type RerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+// rerankResults scores every (query, chunk) pair with the configured cross-encoder
+// and returns the results ordered by descending relevance.
+func (h *Handler) rerankResults(query string, results []SearchResult) ([]SearchResult, error) {
+	if h.config.RerankURL == "" {
+		return nil, fmt.Errorf("no reranker configured (set RERANK_URL)")
+	}
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	docs := make([]string, len(results))
+	for i, res := range results {
+		docs[i] = res.Document
+	}
+
+	reqBody, _ := json.Marshal(RerankRequest{
+		Model:     h.config.RerankModel,
+		Query:     query,
+		Documents: docs,
+		TopN:      len(docs),
+	})
+
+	client := &http.Client{Transport: h.client.Transport, Timeout: h.config.RerankTimeout}
+	resp, err := client.Post(h.config.RerankURL, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("reranker returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var rr RerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		return nil, fmt.Errorf("failed to decode rerank response: %w", err)
+	}
+
+	out := make([]SearchResult, 0, len(rr.Results))
+	for _, scored := range rr.Results {
+		if scored.Index < 0 || scored.Index >= len(results) {
+			return nil, fmt.Errorf("reranker returned out-of-range index %d", scored.Index)
+		}
+		res := results[scored.Index]
+		score := scored.RelevanceScore
+		res.RerankScore = &score
+		out = append(out, res)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return *out[i].RerankScore > *out[j].RerankScore
+	})
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// errRetryBudgetExhausted marks the error an upload is aborted with once it
+// has spent UPLOAD_RETRY_BUDGET.
+var errRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// uploadRetries tracks the retries one upload may still spend. Each failed
+// embedding or storage call is retried up to UPLOAD_RETRIES times, but all
+// calls share UPLOAD_RETRY_BUDGET, so a backend outage aborts a large upload
+// quickly instead of retrying every one of its chunks.
+type uploadRetries struct {
+	perCall   int
+	remaining int
+	budget    int
+	backoff   time.Duration
+}
+
+func (h *Handler) newUploadRetries() *uploadRetries {
+	return &uploadRetries{
+		perCall:   h.config.UploadRetries,
+		remaining: h.config.UploadRetryBudget,
+		budget:    h.config.UploadRetryBudget,
+		backoff:   h.config.UploadRetryBackoff,
+	}
+}
+
+// do runs fn, retrying failures with exponential backoff. It returns fn's
+// last error once the per-call retries are used up, or an uploadError that
+// should abort the upload once the shared budget is.
+func (u *uploadRetries) do(ctx context.Context, what string, fn func() error) error {
+	backoff := u.backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= u.perCall {
+			return err
+		}
+		if u.remaining <= 0 {
+			return &uploadError{
+				status: http.StatusServiceUnavailable,
+				msg:    fmt.Sprintf("upload aborted: retry budget of %d exhausted (last error from %s: %v)", u.budget, what, err),
+				err:    errRetryBudgetExhausted,
+			}
+		}
+		u.remaining--
+		log.Printf("[UPLOAD RETRY] %s attempt %d/%d failed, retrying in %s (%d retries left for this upload): %v",
+			what, attempt+1, u.perCall+1, backoff, u.remaining, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// budgetExhausted reports whether err means the upload ran out of retries.
+func budgetExhausted(err error) bool {
+	return errors.Is(err, errRetryBudgetExhausted)
+}
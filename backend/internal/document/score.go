@@ -0,0 +1,44 @@
+package document
+
+import (
+	"fmt"
+	"math"
+)
+
+// Score functions (SCORE_FUNCTION) mapping a Chroma distance to the score
+// shown in search results. They only change the displayed number and the
+// thresholds compared against it; result order is always by distance.
+const (
+	// scoreLinear is 1 - distance/scale, the historical behaviour with scale 1.
+	scoreLinear = "linear"
+	// scoreInverse is 1 / (1 + distance/scale), always in (0, 1].
+	scoreInverse = "inverse"
+	// scoreSigmoid is 1 / (1 + e^((distance-midpoint)/scale)), which spreads
+	// scores around midpoint; smaller scales make the transition sharper.
+	scoreSigmoid = "sigmoid"
+)
+
+// scoreFunc converts a distance into a score where higher is more similar.
+type scoreFunc func(distance float32) float32
+
+// newScoreFunc returns the named score function with its parameters applied.
+func newScoreFunc(name string, scale, midpoint float64) (scoreFunc, error) {
+	if scale <= 0 {
+		return nil, fmt.Errorf("scale must be positive, got %g", scale)
+	}
+	switch name {
+	case scoreLinear:
+		return func(d float32) float32 {
+			return float32(1 - float64(d)/scale)
+		}, nil
+	case scoreInverse:
+		return func(d float32) float32 {
+			return float32(1 / (1 + math.Max(float64(d), 0)/scale))
+		}, nil
+	case scoreSigmoid:
+		return func(d float32) float32 {
+			return float32(1 / (1 + math.Exp((float64(d)-midpoint)/scale)))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown score function %q", name)
+}
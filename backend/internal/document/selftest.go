@@ -0,0 +1,118 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// selfTestTexts are ingested into a throwaway collection; the first one is
+// searched for and must come back as the top hit.
+var selfTestTexts = []string{
+	"The gowise self-test checks that the lighthouse keeper feeds the cat at dawn.",
+	"Quarterly revenue grew by twelve percent on strong subscription renewals.",
+	"Photosynthesis converts light energy into chemical energy stored in glucose.",
+}
+
+// SelfTestStage is the outcome of one step of the self-test.
+type SelfTestStage struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SelfTestResponse is returned by HandleSelfTest.
+type SelfTestResponse struct {
+	Status     string          `json:"status"`
+	Model      string          `json:"model"`
+	Collection string          `json:"collection"`
+	Stages     []SelfTestStage `json:"stages"`
+}
+
+// HandleSelfTest runs the ingest and search pipeline end to end against a
+// temporary collection: embed a few known texts, add them to Chroma, query
+// for one of them, check it ranks first, and drop the collection again.
+func (h *Handler) HandleSelfTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Embedding and a round trip through a new collection can outlive the
+	// server write timeout when a model has to load first.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[SELFTEST WARNING] Could not clear write deadline: %v", err)
+	}
+
+	collection := "selftest-" + uuid.New().String()[:8]
+	resp := SelfTestResponse{Status: "pass", Model: h.config.DefaultModel, Collection: collection}
+	stage := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		s := SelfTestStage{Name: name, OK: err == nil, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			s.Error = err.Error()
+			resp.Status = "fail"
+			log.Printf("[SELFTEST] Stage %s failed: %v", name, err)
+		}
+		resp.Stages = append(resp.Stages, s)
+		return err == nil
+	}
+
+	var chunks []pendingChunk
+	var queryEmbedding []float32
+	ok := stage("embed", func() error {
+		for i, text := range selfTestTexts {
+			embedding, err := h.embedDocument(r.Context(), text, h.config.DefaultModel)
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, pendingChunk{text: text, embedding: embedding, chunkNum: i + 1, page: 1, pageEnd: 1, kind: chunkText})
+		}
+		var err error
+		queryEmbedding, err = h.embedQuery(r.Context(), selfTestTexts[0], h.config.DefaultModel)
+		return err
+	})
+
+	created := false
+	ok = ok && stage("add", func() error {
+		created = true
+		_, err := h.addToChroma(chunks, ingestDoc{filename: "selftest.txt", collection: collection, documentID: uuid.New().String()})
+		return err
+	})
+
+	if ok {
+		stage("query", func() error {
+			res, err := h.queryChroma(r.Context(), collection, queryEmbedding, len(selfTestTexts), false, nil)
+			if err != nil {
+				return err
+			}
+			results := toSearchResults(res, 0, collection, h.score)
+			if len(results) == 0 {
+				return fmt.Errorf("query returned no results")
+			}
+			if results[0].Document != selfTestTexts[0] {
+				return fmt.Errorf("expected the probe text as top result, got %q", snippet(results[0].Document, 60))
+			}
+			return nil
+		})
+	}
+
+	if created {
+		stage("cleanup", func() error { return h.deleteCollection(collection) })
+	}
+
+	status := http.StatusOK
+	if resp.Status != "pass" {
+		status = http.StatusServiceUnavailable
+	}
+	log.Printf("[SELFTEST] Result: %s", resp.Status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
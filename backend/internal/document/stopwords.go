@@ -0,0 +1,68 @@
+package document
+
+import (
+	"strings"
+	"unicode"
+)
+
+// englishStopwords is the built-in list selected with QUERY_STOPWORDS=en.
+var englishStopwords = []string{
+	"a", "about", "an", "and", "any", "are", "as", "at", "be", "been", "but", "by",
+	"can", "could", "did", "do", "does", "for", "from", "had", "has", "have", "how",
+	"i", "if", "in", "into", "is", "it", "its", "me", "my", "of", "on", "or", "our",
+	"please", "should", "so", "tell", "that", "the", "their", "there", "these",
+	"this", "to", "was", "we", "were", "what", "when", "where", "which", "who",
+	"why", "will", "with", "would", "you", "your",
+}
+
+// parseStopwords reads QUERY_STOPWORDS: "en" selects the built-in English
+// list, anything else is a comma-separated list of words. Empty disables
+// filtering and returns nil.
+func parseStopwords(spec string) map[string]bool {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil
+	}
+	words := strings.Split(spec, ",")
+	if strings.EqualFold(spec, "en") || strings.EqualFold(spec, "english") {
+		words = englishStopwords
+	}
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			set[w] = true
+		}
+	}
+	return set
+}
+
+// prepareQuery returns the text embedded for a search query: normalized
+// when NORMALIZE_TEXT is on, then stripped of QUERY_STOPWORDS.
+func (h *Handler) prepareQuery(query string) string {
+	if h.config.NormalizeText {
+		query = normalizeText(query)
+	}
+	return removeStopwords(query, h.config.QueryStopwords)
+}
+
+// removeStopwords drops stopwords from a query before it is embedded. If
+// nothing but stopwords remains the query is returned unchanged, since an
+// empty query can't be embedded and "what is the" is still better than nothing.
+func removeStopwords(query string, stopwords map[string]bool) string {
+	if len(stopwords) == 0 {
+		return query
+	}
+	var kept []string
+	for _, word := range strings.Fields(query) {
+		bare := strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}))
+		if !stopwords[bare] {
+			kept = append(kept, word)
+		}
+	}
+	if len(kept) == 0 {
+		return query
+	}
+	return strings.Join(kept, " ")
+}
@@ -0,0 +1,208 @@
+package document
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultSuggestLimit = 8
+	maxSuggestLimit     = 50
+	// minSuggestPrefix is how much of the word being typed is needed before suggesting.
+	minSuggestPrefix = 2
+	// minTermLength keeps short function words ("is", "of") out of the index.
+	minTermLength = 3
+	// maxIndexedTerms bounds memory per collection; past it, single-occurrence terms are dropped.
+	maxIndexedTerms = 200000
+)
+
+// termIndex counts how often each word occurs in the chunks of one collection.
+type termIndex struct {
+	counts map[string]int
+}
+
+// suggestIndex holds a termIndex per collection. A collection's index is
+// built from Chroma on its first /api/suggest request and then kept up to
+// date as chunks are stored; resets and deletes drop it so it is rebuilt.
+type suggestIndex struct {
+	mu          sync.Mutex
+	collections map[string]*termIndex
+}
+
+func newSuggestIndex() *suggestIndex {
+	return &suggestIndex{collections: make(map[string]*termIndex)}
+}
+
+// indexTerms splits text into lowercase words worth suggesting.
+func indexTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	terms := words[:0]
+	for _, w := range words {
+		w = strings.Trim(w, "-")
+		if len([]rune(w)) < minTermLength || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+func (t *termIndex) add(texts []string) {
+	for _, text := range texts {
+		for _, term := range indexTerms(text) {
+			t.counts[term]++
+		}
+	}
+	if len(t.counts) > maxIndexedTerms {
+		for term, n := range t.counts {
+			if n == 1 {
+				delete(t.counts, term)
+			}
+		}
+	}
+}
+
+// record adds newly stored chunk texts to a collection's index, if it has been built.
+func (s *suggestIndex) record(collection string, texts []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.collections[collection]; t != nil {
+		t.add(texts)
+	}
+}
+
+// forget drops a collection's index so the next suggestion rebuilds it.
+func (s *suggestIndex) forget(collection string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.collections, collection)
+}
+
+// Suggestion is one query completion with how often its last word occurs.
+type Suggestion struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// SuggestResponse is returned by HandleSuggest.
+type SuggestResponse struct {
+	Query       string       `json:"query"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// suggest completes the last word of query with the most frequent indexed
+// terms starting with it, keeping the words before it.
+func (t *termIndex) suggest(query string, limit int) []Suggestion {
+	suggestions := []Suggestion{}
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 || strings.HasSuffix(query, " ") {
+		return suggestions
+	}
+	prefix := fields[len(fields)-1]
+	if len([]rune(prefix)) < minSuggestPrefix {
+		return suggestions
+	}
+	lead := strings.Join(fields[:len(fields)-1], " ")
+	if lead != "" {
+		lead += " "
+	}
+
+	for term, n := range t.counts {
+		if strings.HasPrefix(term, prefix) {
+			suggestions = append(suggestions, Suggestion{Text: lead + term, Count: n})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Count != suggestions[j].Count {
+			return suggestions[i].Count > suggestions[j].Count
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// termIndexFor returns the collection's index, building it from every chunk
+// stored in Chroma the first time.
+func (h *Handler) termIndexFor(collection string) (*termIndex, error) {
+	h.suggest.mu.Lock()
+	t := h.suggest.collections[collection]
+	h.suggest.mu.Unlock()
+	if t != nil {
+		return t, nil
+	}
+
+	colID, err := h.collectionID(collection)
+	if err != nil {
+		return nil, err
+	}
+	built := &termIndex{counts: make(map[string]int)}
+	err = h.iterateCollection(colID, exportPageSize, []string{"documents"}, func(page *ChromaGetRecordsResponse) error {
+		built.add(page.Documents)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[SUGGEST] Built term index for %s: %d terms", collection, len(built.counts))
+
+	h.suggest.mu.Lock()
+	defer h.suggest.mu.Unlock()
+	if existing := h.suggest.collections[collection]; existing != nil {
+		return existing, nil
+	}
+	h.suggest.collections[collection] = built
+	return built, nil
+}
+
+// HandleSuggest returns completions for a partially typed query, ranked by
+// how often the completed word occurs in the collection.
+func (h *Handler) HandleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	limit := defaultSuggestLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxSuggestLimit {
+			limit = parsed
+		}
+	}
+	collection, err := h.requestCollection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The first request for a collection builds its index from every chunk,
+	// which outlives the server write timeout on a large collection.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[SUGGEST WARNING] Could not clear write deadline: %v", err)
+	}
+
+	index, err := h.termIndexFor(collection)
+	if err != nil {
+		http.Error(w, "failed to load suggestions: "+err.Error(), collectionErrorStatus(err))
+		return
+	}
+
+	h.suggest.mu.Lock()
+	suggestions := index.suggest(query, limit)
+	h.suggest.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SuggestResponse{Query: query, Suggestions: suggestions})
+}
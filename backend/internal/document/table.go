@@ -0,0 +1,153 @@
+package document
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Table detection works on the positioned text runs of a page. GetTextByRow
+// reports no glyph widths, so run extents are estimated from an average
+// character width; a horizontal gap of cellGap or more starts a new cell.
+const (
+	approxCharWidth = 5.0  // points, typical for 10-11pt body text
+	cellGap         = 10.0 // points between runs that separates two cells
+	columnTolerance = 15.0 // points two cell starts may differ and still share a column
+	minTableRows    = 3    // header plus at least two data rows
+	maxTableColumns = 20   // more "cells" than this is per-glyph positioning, not a table
+)
+
+// pdfTable is a table found on a PDF page. The first row is used as the header.
+type pdfTable struct {
+	page int
+	rows [][]string
+}
+
+// detectTables finds runs of consecutive rows on a page that split into the
+// same number (2+) of cells whose start positions line up, which is how
+// tables look once a PDF's drawing operators are reduced to text.
+func detectTables(rows pdf.Rows, page int) []pdfTable {
+	sorted := make(pdf.Rows, len(rows))
+	copy(sorted, rows)
+	// PDF Y grows upwards, so the top of the page comes first in descending order.
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Position > sorted[j].Position })
+
+	var tables []pdfTable
+	var cur [][]string
+	var curStarts []float64
+	flush := func() {
+		if len(cur) >= minTableRows {
+			tables = append(tables, pdfTable{page: page, rows: cur})
+		}
+		cur, curStarts = nil, nil
+	}
+
+	for _, row := range sorted {
+		cells, starts := splitCells(row.Content)
+		if len(cells) < 2 || len(cells) > maxTableColumns {
+			flush()
+			continue
+		}
+		if cur != nil && !columnsAligned(curStarts, starts) {
+			flush()
+		}
+		if cur == nil {
+			curStarts = starts
+		}
+		cur = append(cur, cells)
+	}
+	flush()
+	return tables
+}
+
+// splitCells joins a row's text runs left to right, starting a new cell at
+// every gap of at least cellGap, and returns the cells with their start X.
+func splitCells(runs pdf.TextHorizontal) ([]string, []float64) {
+	sorted := make([]pdf.Text, 0, len(runs))
+	for _, t := range runs {
+		if strings.TrimSpace(t.S) != "" {
+			sorted = append(sorted, t)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].X < sorted[j].X })
+
+	var cells []string
+	var starts []float64
+	var b strings.Builder
+	end := math.Inf(-1)
+	for _, t := range sorted {
+		if t.X-end >= cellGap && b.Len() > 0 {
+			cells = append(cells, strings.Join(strings.Fields(b.String()), " "))
+			b.Reset()
+		}
+		if b.Len() == 0 {
+			starts = append(starts, t.X)
+		}
+		b.WriteString(t.S)
+		end = t.X + float64(utf8.RuneCountInString(t.S))*approxCharWidth
+	}
+	if b.Len() > 0 {
+		cells = append(cells, strings.Join(strings.Fields(b.String()), " "))
+	}
+	return cells, starts
+}
+
+// columnsAligned reports whether two rows have the same number of cells and
+// at least half of their cells start in the same place. Right-aligned
+// numeric columns don't share a left edge, so not every column must match.
+func columnsAligned(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	aligned := 0
+	for i := range a {
+		if math.Abs(a[i]-b[i]) <= columnTolerance {
+			aligned++
+		}
+	}
+	return aligned*2 >= len(a)
+}
+
+// markdownChunks serializes the table as Markdown tables of at most maxWords
+// words each (but always at least one data row), repeating the header in
+// every chunk so each one stands alone.
+func (t pdfTable) markdownChunks(maxWords int) []string {
+	header := markdownRow(t.rows[0])
+	separator := "|" + strings.Repeat(" --- |", len(t.rows[0]))
+	headerWords := len(strings.Fields(header))
+
+	var chunks []string
+	var b strings.Builder
+	words := 0
+	start := func() {
+		b.Reset()
+		b.WriteString(header + "\n" + separator + "\n")
+		words = headerWords
+	}
+	start()
+	for _, row := range t.rows[1:] {
+		line := markdownRow(row)
+		n := len(strings.Fields(line))
+		if words > headerWords && words+n > maxWords {
+			chunks = append(chunks, strings.TrimRight(b.String(), "\n"))
+			start()
+		}
+		b.WriteString(line + "\n")
+		words += n
+	}
+	if words > headerWords {
+		chunks = append(chunks, strings.TrimRight(b.String(), "\n"))
+	}
+	return chunks
+}
+
+func markdownRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for i, c := range cells {
+		escaped[i] = strings.ReplaceAll(c, "|", `\|`)
+	}
+	return "| " + strings.Join(escaped, " | ") + " |"
+}
@@ -0,0 +1,34 @@
+package document
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkTempDir verifies that uploads can be spooled: the temp dir must exist,
+// accept new files and, where the platform can tell, have at least
+// TempDirMinFree bytes available.
+func (h *Handler) checkTempDir() error {
+	dir := h.config.TempDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	f, err := os.CreateTemp(dir, ".gowise-probe-*")
+	if err != nil {
+		return fmt.Errorf("temp dir %s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	f.Close()
+	os.Remove(name)
+
+	if h.config.TempDirMinFree <= 0 {
+		return nil
+	}
+	free, ok := diskFree(dir)
+	if ok && free < uint64(h.config.TempDirMinFree) {
+		return fmt.Errorf("temp dir %s has %d MB free, below the %d MB minimum",
+			dir, free>>20, h.config.TempDirMinFree>>20)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package document
+
+import (
+	"fmt"
+	"time"
+)
+
+// ingestedAtUnixKey is the chunk metadata holding ingested_at as unix seconds,
+// since Chroma's $gte/$lte only compare numbers.
+const ingestedAtUnixKey = "ingested_at_unix"
+
+// parseTimeParam reads a since/until search parameter: an RFC3339 timestamp
+// or a plain date, which means midnight UTC.
+func parseTimeParam(name, v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid %s %q: expected RFC3339 (2024-05-01T12:00:00Z) or a date (2024-05-01)", name, v)
+}
+
+// timeRangeFilter restricts matches to chunks ingested in [since, until];
+// either bound may be zero. It returns nil when both are. Chunks stored
+// before ingestion timestamps existed have no ingested_at_unix and never match.
+func timeRangeFilter(since, until time.Time) map[string]interface{} {
+	var conds []map[string]interface{}
+	if !since.IsZero() {
+		conds = append(conds, map[string]interface{}{ingestedAtUnixKey: map[string]interface{}{"$gte": since.Unix()}})
+	}
+	if !until.IsZero() {
+		conds = append(conds, map[string]interface{}{ingestedAtUnixKey: map[string]interface{}{"$lte": until.Unix()}})
+	}
+	return andFilters(conds...)
+}
+
+// andFilters combines where filters, skipping nil ones. Chroma rejects an
+// $and with fewer than two operands, so those cases are unwrapped.
+func andFilters(filters ...map[string]interface{}) map[string]interface{} {
+	var ops []interface{}
+	for _, f := range filters {
+		if f != nil {
+			ops = append(ops, f)
+		}
+	}
+	switch len(ops) {
+	case 0:
+		return nil
+	case 1:
+		return ops[0].(map[string]interface{})
+	}
+	return map[string]interface{}{"$and": ops}
+}
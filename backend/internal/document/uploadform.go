@@ -0,0 +1,165 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// maxFormValueBytes caps the combined size of an upload form's plain fields.
+const maxFormValueBytes = 1 << 20
+
+// uploadForm is a multipart upload read by readUploadForm: the file, already
+// checked against ALLOWED_EXTENSIONS and its content, and the other fields.
+type uploadForm struct {
+	filename string
+	ext      string
+	// head is the start of the file, as sniffed for its type.
+	head   []byte
+	src    io.ReaderAt
+	size   int64
+	values url.Values
+	// tmpFile is where a file over UPLOAD_MEMORY_THRESHOLD was spooled.
+	tmpFile *os.File
+}
+
+// FormValue returns the first value of the named form field, falling back
+// to the query string like http.Request.FormValue.
+func (f *uploadForm) FormValue(key string) string {
+	return f.values.Get(key)
+}
+
+// Close removes the spooled temp file, if any.
+func (f *uploadForm) Close() {
+	if f.tmpFile != nil {
+		f.tmpFile.Close()
+		os.Remove(f.tmpFile.Name())
+	}
+}
+
+// readUploadForm streams a multipart upload. The file, the first part under
+// any of the UPLOAD_FIELD_NAMES, is rejected with 415 from its name and
+// sniffed leading bytes before any of it is stored; otherwise it is held in
+// memory up to UPLOAD_MEMORY_THRESHOLD and spooled to UPLOAD_TEMP_DIR beyond
+// that. Errors are uploadErrors carrying the status to reject the request
+// with. The caller must Close the form.
+func (h *Handler) readUploadForm(r *http.Request) (*uploadForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, &uploadError{status: http.StatusBadRequest, msg: fmt.Sprintf("failed to parse form: %v", err)}
+	}
+
+	var form *uploadForm
+	values := url.Values{}
+	valueBytes := 0
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if form != nil {
+				form.Close()
+			}
+			return nil, &uploadError{status: http.StatusBadRequest, msg: fmt.Sprintf("failed to parse form: %v", err)}
+		}
+
+		name := part.FormName()
+		if part.FileName() == "" {
+			data, err := io.ReadAll(io.LimitReader(part, int64(maxFormValueBytes-valueBytes)+1))
+			valueBytes += len(data)
+			if err == nil && valueBytes > maxFormValueBytes {
+				err = fmt.Errorf("form fields exceed %d bytes", maxFormValueBytes)
+			}
+			if err != nil {
+				if form != nil {
+					form.Close()
+				}
+				return nil, &uploadError{status: http.StatusBadRequest, msg: fmt.Sprintf("failed to parse form: %v", err)}
+			}
+			values.Add(name, string(data))
+			continue
+		}
+		if form != nil || !slices.Contains(h.config.UploadFieldNames, name) {
+			continue
+		}
+		if form, err = h.receiveUploadFile(part); err != nil {
+			return nil, err
+		}
+	}
+
+	if form == nil {
+		return nil, &uploadError{
+			status: http.StatusBadRequest,
+			msg:    fmt.Sprintf("no file found in the form; send it in one of these fields: %s", strings.Join(h.config.UploadFieldNames, ", ")),
+		}
+	}
+	for key, vs := range r.URL.Query() {
+		values[key] = append(values[key], vs...)
+	}
+	form.values = values
+	return form, nil
+}
+
+// receiveUploadFile checks an upload's file part and then stores it.
+func (h *Handler) receiveUploadFile(part *multipart.Part) (*uploadForm, error) {
+	form := &uploadForm{filename: sanitizeFilename(part.FileName())}
+
+	// Reject unsupported types before anything touches disk, checking both the
+	// name and the leading bytes so a renamed binary is caught too.
+	ext, ok := h.allowedExtension(form.filename)
+	if !ok {
+		log.Printf("[UPLOAD REJECTED] File: %s | Extension %q not allowed", form.filename, ext)
+		return nil, &uploadError{
+			status: http.StatusUnsupportedMediaType,
+			msg:    fmt.Sprintf("file type %q is not allowed (allowed: %s)", ext, strings.Join(h.config.AllowedExtensions, ", ")),
+		}
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(part, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, &uploadError{status: http.StatusBadRequest, msg: fmt.Sprintf("failed to read file: %v", err)}
+	}
+	head = head[:n]
+	if !contentMatchesExtension(ext, head) {
+		log.Printf("[UPLOAD REJECTED] File: %s | Content does not match extension %s", form.filename, ext)
+		return nil, &uploadError{status: http.StatusUnsupportedMediaType, msg: fmt.Sprintf("file content does not match its %s extension", ext)}
+	}
+	form.ext, form.head = ext, head
+
+	// Small uploads are processed straight from memory; larger ones spill to a temp file.
+	body := io.MultiReader(bytes.NewReader(head), part)
+	var buf bytes.Buffer
+	n64, err := io.CopyN(&buf, body, h.config.InMemoryThreshold+1)
+	if errors.Is(err, io.EOF) {
+		form.src, form.size = bytes.NewReader(buf.Bytes()), n64
+		log.Printf("[UPLOAD BUFFERED] File: %s | Held in memory (%d bytes)", form.filename, form.size)
+		return form, nil
+	}
+	if err != nil {
+		return nil, &uploadError{status: http.StatusBadRequest, msg: fmt.Sprintf("failed to read file: %v", err)}
+	}
+
+	tmpFile, err := os.CreateTemp(h.config.TempDir, "upload-*"+ext)
+	if err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, msg: fmt.Sprintf("failed to create temp file: %v", err)}
+	}
+	form.tmpFile = tmpFile
+	size, err := io.Copy(tmpFile, io.MultiReader(&buf, body))
+	if err != nil {
+		form.Close()
+		log.Printf("[UPLOAD ERROR] File: %s | Failed to save: %v", form.filename, err)
+		return nil, &uploadError{status: http.StatusInternalServerError, msg: fmt.Sprintf("failed to save file: %v", err)}
+	}
+	form.src, form.size = tmpFile, size
+	log.Printf("[UPLOAD SAVED] File: %s | Temp path: %s", form.filename, tmpFile.Name())
+	return form, nil
+}
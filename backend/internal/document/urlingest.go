@@ -0,0 +1,359 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/akhilmk/gowise/internal/httpjson"
+	"github.com/google/uuid"
+)
+
+// URLIngestRequest is the body of POST /api/ingest/url.
+type URLIngestRequest struct {
+	URL            string   `json:"url"`
+	Filename       string   `json:"filename"`
+	Path           string   `json:"path"`
+	Tags           []string `json:"tags"`
+	ChunkSize      int      `json:"chunkSize"`
+	ChunkStride    int      `json:"chunkStride"`
+	EmbeddingModel string   `json:"embeddingModel"`
+	// Force ingests the document even if an identical copy is already stored.
+	Force bool `json:"force"`
+}
+
+// maxFetchRedirects bounds how many redirects a URL fetch follows.
+const maxFetchRedirects = 5
+
+var errBlockedAddress = errors.New("address is not publicly routable")
+
+// carrierGradeNAT is 100.64.0.0/10, shared address space net.IP doesn't flag.
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip may be fetched from: not loopback, private,
+// link-local (which includes cloud metadata endpoints), multicast or
+// unspecified.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || carrierGradeNAT.Contains(ip))
+}
+
+// newFetchClient builds the client that downloads documents for URL ingest.
+// Unless allowPrivate is set, every connection's resolved address is
+// checked just before dialing, so neither a hostname resolving to an
+// internal address nor a redirect to one can reach internal services. No
+// proxy is used, since the check must see the real destination.
+func newFetchClient(userAgent string, timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("%w: %s", errBlockedAddress, host)
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	client := newHTTPClient(userAgent, timeout, transport)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxFetchRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	}
+	return client
+}
+
+// fetchedDocument is a document downloaded for URL ingest.
+type fetchedDocument struct {
+	data []byte
+	// name is the filename suggested by Content-Disposition or the URL path.
+	name        string
+	contentType string
+}
+
+// fetchDocument downloads u, refusing bodies over URL_INGEST_MAX_BYTES.
+// Failures carry the status to report in an uploadError.
+func (h *Handler) fetchDocument(ctx context.Context, u *url.URL) (*fetchedDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, &uploadError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid url: %v", err)}
+	}
+	resp, err := h.fetchClient.Do(req)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errBlockedAddress) {
+			status = http.StatusForbidden
+		}
+		return nil, &uploadError{status: status, msg: fmt.Sprintf("failed to fetch %s: %v", u.Redacted(), err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &uploadError{status: http.StatusBadGateway, msg: fmt.Sprintf("fetching %s returned status %d", u.Redacted(), resp.StatusCode)}
+	}
+	limit := h.config.URLIngestMaxBytes
+	if resp.ContentLength > limit {
+		return nil, &uploadError{status: http.StatusRequestEntityTooLarge, msg: fmt.Sprintf("document is %d bytes, over the %d byte limit", resp.ContentLength, limit)}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, &uploadError{status: http.StatusBadGateway, msg: fmt.Sprintf("failed to download %s: %v", u.Redacted(), err)}
+	}
+	if int64(len(data)) > limit {
+		return nil, &uploadError{status: http.StatusRequestEntityTooLarge, msg: fmt.Sprintf("document is over the %d byte limit", limit)}
+	}
+
+	doc := &fetchedDocument{data: data, contentType: resp.Header.Get("Content-Type")}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		doc.name = params["filename"]
+	}
+	if doc.name == "" {
+		// The final URL, after any redirects.
+		doc.name = path.Base(resp.Request.URL.Path)
+	}
+	return doc, nil
+}
+
+// fetchedFilename picks the name a fetched document is stored under and
+// makes sure its extension reflects the content: a name without an allowed
+// extension gets one from the content type or the content itself, e.g. a
+// PDF served from /download?id=7 becomes "download.pdf".
+func (h *Handler) fetchedFilename(requested string, doc *fetchedDocument) string {
+	name := requested
+	if name == "" {
+		name = doc.name
+	}
+	name = sanitizeFilename(name)
+	if _, ok := h.allowedExtension(name); ok {
+		return name
+	}
+
+	ext := ""
+	mediaType, _, _ := mime.ParseMediaType(doc.contentType)
+	switch {
+	case mediaType == "application/pdf" || bytes.HasPrefix(doc.data, []byte("%PDF-")):
+		ext = ".pdf"
+	case mediaType == "text/markdown":
+		ext = ".md"
+	case strings.HasPrefix(http.DetectContentType(doc.data), "text/plain"):
+		ext = ".txt"
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "document"
+	}
+	return name + ext
+}
+
+// cleanTags trims tags and drops empty ones. Tags are stored comma-joined,
+// so a tag may not contain a comma itself.
+func cleanTags(tags []string) ([]string, error) {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("tag %q must not contain a comma", tag)
+		}
+		out = append(out, tag)
+	}
+	return out, nil
+}
+
+// HandleIngestURL downloads a document from a URL and ingests it like an
+// upload of the same file, applying the same type checks, duplicate and
+// filename collision handling. Internal addresses are refused unless
+// URL_INGEST_ALLOW_PRIVATE is set.
+func (h *Handler) HandleIngestURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	release, ok := h.acquireUploadSlot(r)
+	if !ok {
+		log.Printf("[URL INGEST REJECTED] All %d upload slots busy", h.config.MaxConcurrentUploads)
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many concurrent uploads, please retry later", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	// Fetching and embedding a large document outlives the server write timeout.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[URL INGEST WARNING] Could not clear write deadline: %v", err)
+	}
+
+	var req URLIngestRequest
+	if !httpjson.Decode(w, r, &req) {
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid request: url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	tags, err := cleanTags(req.Tags)
+	if err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	collection, err := h.requestCollection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[URL INGEST START] URL: %s", u.Redacted())
+	fetched, err := h.fetchDocument(r.Context(), u)
+	if err != nil {
+		log.Printf("[URL INGEST ERROR] URL: %s | %v", u.Redacted(), err)
+		status := http.StatusBadGateway
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			status = ue.status
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	filename := h.fetchedFilename(req.Filename, fetched)
+	ext, ok := h.allowedExtension(filename)
+	if !ok {
+		http.Error(w, fmt.Sprintf("file type %q is not allowed (allowed: %s)", ext, strings.Join(h.config.AllowedExtensions, ", ")), http.StatusUnsupportedMediaType)
+		return
+	}
+	src := bytes.NewReader(fetched.data)
+	size := int64(len(fetched.data))
+	head, err := readHead(src)
+	if err != nil || !contentMatchesExtension(ext, head) {
+		http.Error(w, fmt.Sprintf("downloaded content does not match its %s extension", ext), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	fileHash, err := hashFile(src, size)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to hash document: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if h.config.SkipDuplicateUploads && !req.Force {
+		existing, err := h.findIngestedFile(collection, fileHash)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to check for duplicate upload: %v", err), http.StatusBadGateway)
+			return
+		}
+		if existing != nil {
+			log.Printf("[URL INGEST SKIPPED] URL: %s | Identical to already ingested %s (document %s)",
+				u.Redacted(), existing.filename, existing.documentID)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":     "already_ingested",
+				"filename":   existing.filename,
+				"collection": collection,
+				"documentId": existing.documentID,
+				"fileHash":   fileHash,
+				"url":        u.Redacted(),
+			})
+			return
+		}
+	}
+
+	filename, err = h.resolveFilename(collection, filename)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errFilenameTaken) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	chunkSize, chunkStride := 100, 80
+	if req.ChunkSize > 0 {
+		chunkSize = req.ChunkSize
+	}
+	if req.ChunkStride > 0 {
+		chunkStride = req.ChunkStride
+	}
+	if chunkStride > chunkSize {
+		chunkStride = chunkSize
+	}
+	embeddingModel := h.config.DefaultModel
+	if req.EmbeddingModel != "" {
+		embeddingModel = req.EmbeddingModel
+	}
+
+	doc := ingestDoc{
+		filename:   filename,
+		path:       normalizeDocPath(req.Path, filename),
+		collection: collection,
+		documentID: uuid.New().String(),
+		fileHash:   fileHash,
+		sourceURL:  u.Redacted(),
+		tags:       tags,
+	}
+	result, err := h.processPDF(r.Context(), src, size, doc, chunkSize, chunkStride, embeddingModel, nil)
+	if err != nil {
+		log.Printf("[URL INGEST ERROR] URL: %s | %v", u.Redacted(), err)
+		status := http.StatusInternalServerError
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			status = ue.status
+		}
+		http.Error(w, fmt.Sprintf("failed to ingest document: %v", err), status)
+		return
+	}
+
+	log.Printf("[URL INGEST COMPLETE] URL: %s | Stored %d/%d chunks", u.Redacted(), result.StoredChunks, result.TotalChunks)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":              "completed",
+		"filename":            filename,
+		"path":                doc.path,
+		"collection":          collection,
+		"documentId":          doc.documentID,
+		"fileHash":            fileHash,
+		"url":                 u.Redacted(),
+		"tags":                tags,
+		"chunkSize":           chunkSize,
+		"chunkStride":         chunkStride,
+		"totalChunks":         result.TotalChunks,
+		"storedChunks":        result.StoredChunks,
+		"droppedChunks":       result.DroppedChunks,
+		"nearDuplicateChunks": result.NearDuplicateChunks,
+		"tableChunks":         result.TableChunks,
+		"failedChunks":        result.FailedChunks,
+		"embedFailurePolicy":  h.config.EmbedFailurePolicy,
+		"failures":            result.Failures,
+		"failuresTruncated":   result.FailuresTruncated,
+		"truncated":           result.Truncated,
+		"warnings":            result.Warnings,
+	})
+}
@@ -0,0 +1,54 @@
+package document
+
+import "math"
+
+// l2Norm returns the Euclidean length of v.
+func l2Norm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+// normalize returns a unit-length copy of v. Zero vectors are returned unchanged.
+func normalize(v []float32) []float32 {
+	out := make([]float32, len(v))
+	norm := l2Norm(v)
+	if norm == 0 {
+		copy(out, v)
+		return out
+	}
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// truncateDims keeps the first n dimensions of v and re-normalizes them to
+// unit length, as Matryoshka-trained models expect. Vectors with n or fewer
+// dimensions (or n <= 0) are returned unchanged.
+func truncateDims(v []float32, n int) []float32 {
+	if n <= 0 || len(v) <= n {
+		return v
+	}
+	return normalize(v[:n])
+}
+
+// dot returns the dot product of a and b over their shared length.
+func dot(a, b []float32) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// cosineSimilarity is the dot product of the normalized vectors.
+func cosineSimilarity(a, b []float32) float64 {
+	return dot(normalize(a), normalize(b))
+}
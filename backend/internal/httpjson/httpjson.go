@@ -0,0 +1,42 @@
+// Package httpjson decodes JSON request bodies for the HTTP handlers.
+package httpjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MaxBodyBytes caps JSON request bodies so an oversized payload can't exhaust memory.
+const MaxBodyBytes = 64 << 10
+
+// Decode strictly decodes a size-limited JSON request body into v; fields v
+// doesn't define are rejected so client typos surface immediately. On
+// failure it writes the error response (413 for oversized bodies, 400
+// otherwise) and returns false.
+func Decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	return DecodeLimit(w, r, v, MaxBodyBytes)
+}
+
+// DecodeLimit is Decode with a caller-chosen size limit.
+func DecodeLimit(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			http.Error(w, fmt.Sprintf("Invalid request: unknown field %s", field), http.StatusBadRequest)
+			return false
+		}
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -2,18 +2,48 @@
 
 const API_BASE_URL = "/api";
 
+export interface ChunkFailure {
+    chunk: number;
+    error: string;
+}
+
 export interface ProcessingResult {
     status: string;
     filename: string;
     chunkSize: number;
     chunkStride: number;
+    totalChunks?: number;
+    storedChunks?: number;
+    droppedChunks?: number;
+    nearDuplicateChunks?: number;
+    tableChunks?: number;
+    failedChunks?: number;
+    embedFailurePolicy?: string;
+    failures?: ChunkFailure[];
+    failuresTruncated?: boolean;
+    documentId?: string;
+    fileHash?: string;
+    truncated?: boolean;
+    warnings?: string[];
+}
+
+export interface SearchHit {
+    id: string;
+    document: string;
+    metadata: any;
+    distance: number;
+    score: number;
+    rerank_score?: number;
+    boost?: number;
+    boosted_score?: number;
+    embedding?: number[];
+    collection: string;
 }
 
 export interface SearchResult {
-    ids: string[][];
-    documents: string[][];
-    metadatas: any[][];
-    distances: number[][];
+    query: string;
+    results: SearchHit[];
+    reranked: boolean;
 }
 
 export interface StatsResult {
@@ -23,13 +53,19 @@ export interface StatsResult {
     file_chunk_counts: { [key: string]: number };
 }
 
+export interface TokenInfo {
+    username: string;
+    role: string;
+    expires_at?: string;
+}
+
 export interface OllamaModel {
     name: string;
     modified_at: string;
     size: number;
 }
 
-class ApiError extends Error {
+export class ApiError extends Error {
     constructor(public status: number, message: string) {
         super(message);
         this.name = "ApiError";
@@ -72,6 +108,13 @@ export const api = {
         localStorage.removeItem(TOKEN_KEY);
     },
 
+    async validateToken(): Promise<TokenInfo> {
+        const response = await fetch(`${API_BASE_URL}/validate`, {
+            headers: getAuthHeader()
+        });
+        return handleResponse<TokenInfo>(response);
+    },
+
     async getModels(): Promise<{ models: OllamaModel[] }> {
         const response = await fetch(`${API_BASE_URL}/models`, {
             headers: getAuthHeader()
@@ -93,6 +136,12 @@ export const api = {
             signal: signal,
         });
 
+        // Rejected uploads answer with a plain error status before any progress is streamed.
+        if (!response.ok) {
+            console.error(`[UPLOAD ERROR] File: ${fileName} | Status: ${response.status}`);
+            return handleResponse<ProcessingResult>(response);
+        }
+
         if (!response.body) {
             console.error(`[UPLOAD ERROR] File: ${fileName} | Error: Response body is empty`);
             throw new Error("Response body is empty");
@@ -120,7 +169,7 @@ export const api = {
                             console.error(`[UPLOAD ERROR] File: ${fileName} | Error: ${data.error} | Timestamp: ${new Date().toISOString()}`);
                             throw new Error(data.error);
                         }
-                        if (data.status === "completed") {
+                        if (data.status === "completed" || data.status === "already_ingested") {
                             console.log(`[UPLOAD COMPLETE] File: ${fileName} | Timestamp: ${new Date().toISOString()}`);
                             finalResult = data as ProcessingResult;
                         } else if (data.status && onProgress) {
@@ -147,12 +196,8 @@ export const api = {
             return finalResult;
         }
 
-        if (response.ok) {
-            console.error(`[UPLOAD ERROR] File: ${fileName} | Error: Upload process ended without completion status`);
-            throw new Error("Upload process ended without completion status");
-        }
-
-        return handleResponse<ProcessingResult>(response);
+        console.error(`[UPLOAD ERROR] File: ${fileName} | Error: Upload process ended without completion status`);
+        throw new Error("Upload process ended without completion status");
     },
 
     async searchVectors(query: string): Promise<SearchResult> {